@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var convertOutput string
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert LAYOUT_FILE",
+	Short: "Convert an in-toto v1 layout into an in-toto policy",
+	Args:  cobra.ExactArgs(1),
+	RunE:  convert,
+
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Write the policy to this file instead of stdout")
+}
+
+func convert(cmd *cobra.Command, args []string) error {
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	pd, warnings, err := policies.ConvertLayout(raw)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", w)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(pd); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if convertOutput == "" {
+		_, err = cmd.OutOrStdout().Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(convertOutput, buf.Bytes(), 0o644)
+}
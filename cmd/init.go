@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	fromAttestations string
+	initOutput       string
+)
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a starter in-toto policy",
+	Args:  cobra.NoArgs,
+	RunE:  initPolicy,
+
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().StringVar(&fromAttestations, "from-attestations", "", "Directory of attestations to infer the policy from")
+	initCmd.Flags().StringVarP(&initOutput, "output", "o", "", "Write the policy to this file instead of stdout")
+	initCmd.MarkFlagRequired("from-attestations")
+}
+
+func initPolicy(cmd *cobra.Command, args []string) error {
+	if fromAttestations == "" {
+		return errors.New("no attestation directory given")
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+
+	pd, err := policies.GeneratePolicy(cmd.Context(), policies.NewDirectoryAttestationSource(fromAttestations, logger))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(pd); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if initOutput == "" {
+		_, err = cmd.OutOrStdout().Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(initOutput, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+	"github.com/spf13/cobra"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint POLICY_FILE",
+	Short: "Statically check an in-toto policy without attestations",
+	Args:  cobra.ExactArgs(1),
+	RunE:  lint,
+
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
+
+func lint(cmd *cobra.Command, args []string) error {
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	lintErrors, err := policies.Lint(raw)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	for _, e := range lintErrors {
+		fmt.Fprintf(out, "%s:%s\n", args[0], e)
+	}
+	if len(lintErrors) > 0 {
+		return fmt.Errorf("found %d problems in policy", len(lintErrors))
+	}
+	fmt.Fprintln(out, "policy OK")
+	return nil
+}
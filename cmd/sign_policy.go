@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/spf13/cobra"
+)
+
+var (
+	signPolicyKeys   []string
+	signPolicyOutput string
+)
+
+// signPolicyCmd represents the sign-policy command
+var signPolicyCmd = &cobra.Command{
+	Use:   "sign-policy POLICY_FILE",
+	Short: "Sign an in-toto policy with the keys of its owners",
+	Args:  cobra.ExactArgs(1),
+	RunE:  signPolicy,
+
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(signPolicyCmd)
+
+	signPolicyCmd.Flags().StringSliceVarP(&signPolicyKeys, "key", "k", nil, "Private key of a policy owner (can be repeated)")
+	signPolicyCmd.Flags().StringVarP(&signPolicyOutput, "output", "o", "", "Write the signed policy to this file instead of stdout")
+	signPolicyCmd.MarkFlagRequired("key")
+}
+
+func signPolicy(cmd *cobra.Command, args []string) error {
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	payloadType, err := policies.PolicyPayloadType(args[0])
+	if err != nil {
+		return err
+	}
+
+	signers := make([]dsse.Signer, 0, len(signPolicyKeys))
+	for _, k := range signPolicyKeys {
+		keyData, err := os.ReadFile(k)
+		if err != nil {
+			return err
+		}
+		signer, err := policies.LoadSigner(keyData)
+		if err != nil {
+			return fmt.Errorf("failed to load policy key %s: %w", k, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	envelope, err := policies.SignPolicy(cmd.Context(), raw, payloadType, signers...)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	if signPolicyOutput == "" {
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		return err
+	}
+	return os.WriteFile(signPolicyOutput, data, 0o644)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/policytest"
+	"github.com/spf13/cobra"
+)
+
+var junitOutput string
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test MANIFEST",
+	Short: "Run the policy test cases of a test manifest",
+	Args:  cobra.ExactArgs(1),
+	RunE:  test,
+
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+
+	testCmd.Flags().StringVar(&junitOutput, "junit", "", "Write the test results as JUnit XML to this file")
+}
+
+func test(cmd *cobra.Command, args []string) error {
+	m, err := policytest.LoadManifest(args[0])
+	if err != nil {
+		return err
+	}
+	results := policytest.Run(cmd.Context(), m)
+
+	out := cmd.OutOrStdout()
+	failed := 0
+	for _, r := range results {
+		if r.Passed {
+			fmt.Fprintf(out, "PASS\t%s (%s)\n", r.Name, r.Duration)
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "FAIL\t%s (%s)\n\t- %s\n", r.Name, r.Duration, r.Message)
+	}
+
+	if junitOutput != "" {
+		f, err := os.Create(junitOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := policytest.WriteJUnit(f, m, results); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d policy tests failed", failed, len(results))
+	}
+	fmt.Fprintf(out, "%d policy tests passed\n", len(results))
+	return nil
+}
@@ -3,19 +3,38 @@ package cmd
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
-	"path"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/alanssitis/in-toto-policies/pkg/policies"
 	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
-	"gopkg.in/yaml.v3"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	fdir string
-	adir string
+	fdir       string
+	adir       string
+	workers    int
+	vsaOutput  string
+	vsaKey     string
+	verifierID string
+	explain    bool
+
+	resourceURI    string
+	verifiedLevels []string
+
+	policyKeys      []string
+	policyThreshold int
+	policyTrustRoot string
+	verifyAt        string
+	params          []string
+	paramsFile      string
 )
 
 // verifyCmd represents the verify command
@@ -24,6 +43,8 @@ var verifyCmd = &cobra.Command{
 	Short: "Verify the in-toto policy",
 	Args:  cobra.ExactArgs(1),
 	RunE:  verify,
+
+	SilenceUsage: true,
 }
 
 func init() {
@@ -39,31 +60,206 @@ func init() {
 	// is called directly, e.g.:
 	verifyCmd.Flags().StringVarP(&fdir, "functionary-directory", "f", "", "Relative directory to get functionary information")
 	verifyCmd.Flags().StringVarP(&adir, "attestation-directory", "a", "", "Directory to search all attestations")
+	verifyCmd.Flags().IntVarP(&workers, "workers", "j", runtime.GOMAXPROCS(0), "Maximum number of attestation rules verified concurrently")
+	verifyCmd.Flags().StringVar(&vsaOutput, "vsa-output", "", "Write a signed verification summary attestation to this file on success")
+	verifyCmd.Flags().StringVar(&vsaKey, "vsa-key", "", "Private key used to sign the verification summary attestation")
+	verifyCmd.Flags().StringVar(&verifierID, "verifier-id", "https://github.com/alanssitis/in-toto-policies", "Verifier ID recorded in the verification summary attestation")
+	verifyCmd.Flags().StringVar(&resourceURI, "resource-uri", "", "URI of the resource the verification summary attestation is for, e.g. a package URL")
+	verifyCmd.Flags().StringArrayVar(&verifiedLevels, "verified-level", nil, "Level recorded as verified in the verification summary attestation, e.g. SLSA_BUILD_LEVEL_3 (can be repeated)")
+	verifyCmd.Flags().BoolVar(&explain, "explain", false, "Show how artifact rules treated every artifact")
+	verifyCmd.Flags().StringSliceVar(&policyKeys, "policy-key", nil, "Public key of a policy owner that signed the policy (can be repeated)")
+	verifyCmd.Flags().IntVar(&policyThreshold, "policy-threshold", 1, "Number of distinct policy keys that must have signed the policy")
+	verifyCmd.Flags().StringVar(&policyTrustRoot, "policy-trust-root", "", "Trust root file naming the policy owners and their threshold")
+	verifyCmd.Flags().StringVar(&verifyAt, "at", "", "Check the policy validity window and functionary and policy owner certificates at this RFC 3339 time instead of now")
+	verifyCmd.Flags().StringArrayVar(&params, "param", nil, "Policy parameter as name=value, list values are separated by commas (can be repeated)")
+	verifyCmd.Flags().StringVar(&paramsFile, "params-file", "", "YAML or JSON file of policy parameter values, overridden by --param")
+	verifyCmd.MarkFlagsRequiredTogether("vsa-output", "vsa-key")
+	verifyCmd.MarkFlagsMutuallyExclusive("policy-key", "policy-trust-root")
 }
 
 func verify(cmd *cobra.Command, args []string) error {
-	raw, err := os.ReadFile(args[0])
+	at, err := verificationTime()
+	if err != nil {
+		return err
+	}
+	pd, err := loadPolicy(cmd, args[0], at)
 	if err != nil {
 		return err
 	}
 
-	pd := models.PolicyDocument{}
-	policy_ext := path.Ext(args[0])
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
 
-	switch {
-	case policy_ext == ".yml" || policy_ext == ".yaml":
-		err = yaml.Unmarshal(raw, &pd)
-		if err != nil {
-			return err
+	opts := []policies.Option{
+		policies.WithLogger(logger),
+		policies.WithContext(cmd.Context()),
+		policies.WithKeySource(policies.NewDirectoryKeySource(fdir)),
+		policies.WithAttestationSource(policies.NewDirectoryAttestationSource(adir, logger)),
+		policies.WithMaxWorkers(workers),
+		policies.WithExplain(explain),
+	}
+	values, err := parameterValues()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, policies.WithParameters(values))
+	if !at.IsZero() {
+		opts = append(opts, policies.WithVerificationTime(at))
+	}
+	v, err := policies.NewVerifier(opts...)
+	if err != nil {
+		return err
+	}
+	result, err := v.Verify(pd)
+	if err != nil {
+		return err
+	}
+	printResult(cmd, result)
+	if explain {
+		printTrace(cmd, result)
+	}
+	if !result.Passed() {
+		return errors.New("policy verification failed")
+	}
+	if vsaOutput != "" {
+		return writeVSA(cmd, result, args[0])
+	}
+	return nil
+}
+
+// parameterValues merges the parameters file with the --param flags.
+func parameterValues() (map[string]any, error) {
+	values := make(map[string]any)
+	if paramsFile != "" {
+		var err error
+		if values, err = policies.LoadParameters(paramsFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range params {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("policy parameter is not name=value: %s", p)
 		}
-	case policy_ext == ".json":
-		err = json.Unmarshal(raw, &pd)
+		values[name] = value
+	}
+	return values, nil
+}
+
+// verificationTime returns the time given with --at, or the zero time to
+// verify at the current time.
+func verificationTime() (time.Time, error) {
+	if verifyAt == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, verifyAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid verification time: %w", err)
+	}
+	return at, nil
+}
+
+// loadPolicy reads the policy document, verifying its signatures first when
+// policy keys or a trust root are given. Owner certificates are checked at
+// the verification time at, or now if it is zero.
+func loadPolicy(cmd *cobra.Command, path string, at time.Time) (models.PolicyDocument, error) {
+	if len(policyKeys) == 0 && policyTrustRoot == "" {
+		return policies.LoadPolicyDocument(path)
+	}
+
+	var root *models.PolicyTrustRoot
+	var ks policies.KeySource
+	if policyTrustRoot != "" {
+		var err error
+		root, ks, err = policies.LoadPolicyTrustRoot(policyTrustRoot)
 		if err != nil {
-			return err
+			return models.PolicyDocument{}, err
+		}
+	} else {
+		root = &models.PolicyTrustRoot{Threshold: policyThreshold}
+		for _, k := range policyKeys {
+			root.Owners = append(root.Owners, &models.Functionary{Name: k, PublicKeyPath: k})
+		}
+		ks = policies.NewDirectoryKeySource("")
+	}
+	pd, err := policies.LoadSignedPolicyDocument(cmd.Context(), path, root, ks, at)
+	if err != nil {
+		return models.PolicyDocument{}, fmt.Errorf("refusing to verify with policy %s: %w", path, err)
+	}
+	return pd, nil
+}
+
+func writeVSA(cmd *cobra.Command, result *policies.VerificationResult, policyPath string) error {
+	keyData, err := os.ReadFile(vsaKey)
+	if err != nil {
+		return err
+	}
+	signer, err := policies.LoadSigner(keyData)
+	if err != nil {
+		return fmt.Errorf("failed to load verification summary key: %w", err)
+	}
+
+	statement, err := policies.NewVSA(result, policies.VSAOptions{
+		VerifierID:     verifierID,
+		PolicyURI:      policyPath,
+		ResourceURI:    resourceURI,
+		VerifiedLevels: verifiedLevels,
+	})
+	if err != nil {
+		return err
+	}
+	envelope, err := policies.SignStatement(cmd.Context(), statement, signer)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(vsaOutput, data, 0o644)
+}
+
+func printResult(cmd *cobra.Command, result *policies.VerificationResult) {
+	printRuleResults(cmd, result, "")
+	fmt.Fprintf(cmd.OutOrStdout(), "policy verification %s\n", result.Status)
+}
+
+// printRuleResults prints the attestation rules of sub-policies first,
+// prefixed with their namespace.
+func printRuleResults(cmd *cobra.Command, result *policies.VerificationResult, namespace string) {
+	out := cmd.OutOrStdout()
+	for _, sp := range result.SubPolicies {
+		printRuleResults(cmd, sp.Result, namespace+sp.Name+".")
+	}
+	for _, ar := range result.AttestationRules {
+		fmt.Fprintf(out, "%s\t%s%s", ar.Status, namespace, ar.Name)
+		if len(ar.AttestationFiles) > 0 {
+			fmt.Fprintf(out, " (%s)", strings.Join(ar.AttestationFiles, ", "))
+		}
+		fmt.Fprintln(out)
+		for _, r := range ar.Reasons {
+			fmt.Fprintf(out, "\t- %s\n", r)
 		}
-	default:
-		return errors.New("unsupported file extension for test policy file")
 	}
+}
 
-	return policies.Verify(pd, fdir, adir)
+func printTrace(cmd *cobra.Command, result *policies.VerificationResult) {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nATTESTATION RULE\tFIELD\tARTIFACT\tARTIFACT RULE\tOUTCOME\tREASON")
+	printRuleTraces(w, result, "")
+	w.Flush()
+}
+
+func printRuleTraces(w io.Writer, result *policies.VerificationResult, namespace string) {
+	for _, sp := range result.SubPolicies {
+		printRuleTraces(w, sp.Result, namespace+sp.Name+".")
+	}
+	for _, ar := range result.AttestationRules {
+		for _, t := range ar.Trace {
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n", namespace, ar.Name, t.Field, t.Artifact, t.Rule, t.Outcome, t.Reason)
+		}
+	}
 }
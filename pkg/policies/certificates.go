@@ -0,0 +1,207 @@
+package policies
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// certificateFunctionary is a functionary identified by leaf certificates
+// that chain to a trust root and satisfy the policy's constraints.
+type certificateFunctionary struct {
+	constraints   *models.CertificateConstraints
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+}
+
+func newCertificateFunctionary(c *models.CertificateConstraints, dir string) (*certificateFunctionary, error) {
+	if c.RootsPath == "" {
+		return nil, errors.New("certificate functionary requires a roots path")
+	}
+	roots, err := loadCertificates(filepath.Join(dir, c.RootsPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trust roots: %w", err)
+	}
+	cf := &certificateFunctionary{
+		constraints: c,
+		roots:       x509.NewCertPool(),
+	}
+	for _, r := range roots {
+		cf.roots.AddCert(r)
+	}
+	if c.IntermediatesPath != "" {
+		cf.intermediates, err = loadCertificates(filepath.Join(dir, c.IntermediatesPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load intermediates: %w", err)
+		}
+	}
+	return cf, nil
+}
+
+func (cf *certificateFunctionary) Verifiers(a *Attestation, at time.Time) ([]dsse.Verifier, error) {
+	var vs []dsse.Verifier
+	var errs []error
+	for i, chain := range a.Certificates {
+		if chain == "" {
+			continue
+		}
+		certs, err := parseCertificates([]byte(chain))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := cf.verifyCertificate(certs[0], certs[1:], at); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v, err := newPublicKeyVerifier(certs[0].PublicKey, a.Envelope.Signatures[i].KeyID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		vs = append(vs, v)
+	}
+	if len(vs) == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("attestation carries no signing certificates")
+		}
+		return nil, joinErrors(errs)
+	}
+	return vs, nil
+}
+
+func (cf *certificateFunctionary) verifyCertificate(leaf *x509.Certificate, carried []*x509.Certificate, at time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, c := range slices.Concat(cf.intermediates, carried) {
+		intermediates.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         cf.roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate does not chain to trust root: %w", err)
+	}
+	return checkCertificateConstraints(leaf, cf.constraints)
+}
+
+func checkCertificateConstraints(leaf *x509.Certificate, c *models.CertificateConstraints) error {
+	if c.CommonName != "" && leaf.Subject.CommonName != c.CommonName {
+		return fmt.Errorf("certificate common name %q is not %q", leaf.Subject.CommonName, c.CommonName)
+	}
+	if len(c.DNSNames) > 0 && !containsAny(leaf.DNSNames, c.DNSNames) {
+		return errors.New("certificate has none of the allowed DNS names")
+	}
+	if len(c.Emails) > 0 && !containsAny(leaf.EmailAddresses, c.Emails) {
+		return errors.New("certificate has none of the allowed email addresses")
+	}
+	if len(c.URIs) > 0 {
+		uris := make([]string, len(leaf.URIs))
+		for i, u := range leaf.URIs {
+			uris[i] = u.String()
+		}
+		if !containsAny(uris, c.URIs) {
+			return errors.New("certificate has none of the allowed URIs")
+		}
+	}
+	for _, eku := range c.ExtKeyUsages {
+		if !hasExtKeyUsage(leaf, eku) {
+			return fmt.Errorf("certificate is missing extended key usage %s", eku)
+		}
+	}
+	for oid, value := range c.Extensions {
+		if !hasExtension(leaf, oid, value) {
+			return fmt.Errorf("certificate is missing extension %s with the expected value", oid)
+		}
+	}
+	return nil
+}
+
+func hasExtKeyUsage(leaf *x509.Certificate, eku string) bool {
+	if usage, ok := extKeyUsages[eku]; ok {
+		return slices.Contains(leaf.ExtKeyUsage, usage)
+	}
+	for _, oid := range leaf.UnknownExtKeyUsage {
+		if oid.String() == eku {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtension(leaf *x509.Certificate, oid, value string) bool {
+	for _, ext := range leaf.Extensions {
+		if ext.Id.String() != oid {
+			continue
+		}
+		if value == "" || string(ext.Value) == value {
+			return true
+		}
+		var s string
+		if _, err := asn1.Unmarshal(ext.Value, &s); err == nil && s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(have, allowed []string) bool {
+	for _, h := range have {
+		if slices.Contains(allowed, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificates(data)
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,183 @@
+package policies
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+)
+
+// testCertificate is a certificate generated for a test along with its key.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCertificate issues a certificate from template signed by parent, or
+// a self-signed one when parent is nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issueTestCertificate(t, template, key, parent)
+}
+
+func issueTestCertificate(t *testing.T, template *x509.Certificate, key *ecdsa.PrivateKey, parent *testCertificate) *testCertificate {
+	t.Helper()
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	issuer, signer := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+func testCATemplate(name string, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+func testLeafTemplate(notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com"},
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	now := time.Now()
+	root := newTestCertificate(t, testCATemplate("root", now.Add(-24*time.Hour), now.Add(24*time.Hour)), nil)
+	otherRoot := newTestCertificate(t, testCATemplate("other root", now.Add(-24*time.Hour), now.Add(24*time.Hour)), nil)
+	intermediate := newTestCertificate(t, testCATemplate("intermediate", now.Add(-24*time.Hour), now.Add(24*time.Hour)), root)
+	leaf := newTestCertificate(t, testLeafTemplate(now.Add(-time.Hour), now.Add(time.Hour)), intermediate)
+	expired := newTestCertificate(t, testLeafTemplate(now.Add(-2*time.Hour), now.Add(-time.Hour)), intermediate)
+
+	tests := []struct {
+		name          string
+		root          *testCertificate
+		intermediates []*x509.Certificate
+		carried       []*x509.Certificate
+		leaf          *testCertificate
+		at            time.Time
+		wantErr       string
+	}{
+		{
+			name:          "leaf chaining through a configured intermediate",
+			root:          root,
+			intermediates: []*x509.Certificate{intermediate.cert},
+			leaf:          leaf,
+			at:            now,
+		},
+		{
+			name:    "leaf chaining through a carried intermediate",
+			root:    root,
+			carried: []*x509.Certificate{intermediate.cert},
+			leaf:    leaf,
+			at:      now,
+		},
+		{
+			name:          "expired leaf",
+			root:          root,
+			intermediates: []*x509.Certificate{intermediate.cert},
+			leaf:          expired,
+			at:            now,
+			wantErr:       "certificate has expired or is not yet valid",
+		},
+		{
+			name:          "expired leaf at a verification time it was valid",
+			root:          root,
+			intermediates: []*x509.Certificate{intermediate.cert},
+			leaf:          expired,
+			at:            now.Add(-90 * time.Minute),
+		},
+		{
+			name:          "leaf at a verification time after it expired",
+			root:          root,
+			intermediates: []*x509.Certificate{intermediate.cert},
+			leaf:          leaf,
+			at:            now.Add(2 * time.Hour),
+			wantErr:       "certificate has expired or is not yet valid",
+		},
+		{
+			name:          "wrong root",
+			root:          otherRoot,
+			intermediates: []*x509.Certificate{intermediate.cert},
+			leaf:          leaf,
+			at:            now,
+			wantErr:       "certificate does not chain to trust root",
+		},
+		{
+			name:    "missing intermediate",
+			root:    root,
+			leaf:    leaf,
+			at:      now,
+			wantErr: "certificate does not chain to trust root",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := &certificateFunctionary{
+				constraints:   &models.CertificateConstraints{Emails: []string{"alice@example.com"}},
+				roots:         x509.NewCertPool(),
+				intermediates: tt.intermediates,
+			}
+			cf.roots.AddCert(tt.root.cert)
+
+			err := cf.verifyCertificate(tt.leaf.cert, tt.carried, tt.at)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyCertificateConstraints(t *testing.T) {
+	now := time.Now()
+	root := newTestCertificate(t, testCATemplate("root", now.Add(-24*time.Hour), now.Add(24*time.Hour)), nil)
+	leaf := newTestCertificate(t, testLeafTemplate(now.Add(-time.Hour), now.Add(time.Hour)), root)
+
+	cf := &certificateFunctionary{
+		constraints: &models.CertificateConstraints{Emails: []string{"bob@example.com"}},
+		roots:       x509.NewCertPool(),
+	}
+	cf.roots.AddCert(root.cert)
+	err := cf.verifyCertificate(leaf.cert, nil, now)
+	if err == nil || !strings.Contains(err.Error(), "none of the allowed email addresses") {
+		t.Fatalf("expected email constraint to fail, got: %v", err)
+	}
+}
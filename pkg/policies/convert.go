@@ -0,0 +1,315 @@
+package policies
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+)
+
+const (
+	linkPredicateType = "https://in-toto.io/attestation/link/v0.3"
+	materialsField    = "this.predicate.materials"
+	productsField     = "this.subject"
+)
+
+type legacyLayout struct {
+	Type    string                     `json:"_type"`
+	Expires *time.Time                 `json:"expires"`
+	Keys    map[string]json.RawMessage `json:"keys"`
+	Steps   []*legacyStep              `json:"steps"`
+	Inspect []*legacyStep              `json:"inspect"`
+}
+
+type legacyStep struct {
+	Name              string     `json:"name"`
+	Threshold         int        `json:"threshold"`
+	PubKeys           []string   `json:"pubkeys"`
+	ExpectedCommand   []string   `json:"expected_command"`
+	ExpectedMaterials [][]string `json:"expected_materials"`
+	ExpectedProducts  [][]string `json:"expected_products"`
+}
+
+// ConvertLayout converts an in-toto v1 layout, either as a signed metablock
+// or as a DSSE envelope, into a policy document. Layout keys become
+// functionaries with inline public keys and steps become link attestation
+// rules. Everything that cannot be expressed in a policy document, such as
+// inspections, is returned as a warning instead of failing the conversion.
+// The signatures of the layout are not verified.
+func ConvertLayout(raw []byte) (*models.PolicyDocument, []string, error) {
+	layout, err := decodeLayout(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if layout.Type != "layout" {
+		return nil, nil, fmt.Errorf("not an in-toto layout: %s", layout.Type)
+	}
+
+	c := &layoutConverter{layout: layout, names: make(map[string]string)}
+	pd := &models.PolicyDocument{Expires: layout.Expires}
+
+	keyIDs := make([]string, 0, len(layout.Keys))
+	for keyID := range layout.Keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	slices.Sort(keyIDs)
+	for _, keyID := range keyIDs {
+		// The key ID of a layout key may only be given by its map key.
+		var key map[string]any
+		if err := json.Unmarshal(layout.Keys[keyID], &key); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse layout key %s: %w", keyID, err)
+		}
+		key["keyid"] = keyID
+		publicKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := functionaryName(keyID)
+		c.names[keyID] = name
+		pd.Functionaries = append(pd.Functionaries, &models.Functionary{
+			Name:      name,
+			PublicKey: string(publicKey),
+		})
+	}
+
+	for _, step := range layout.Steps {
+		rule, err := c.convertStep(step)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert step %s: %w", step.Name, err)
+		}
+		pd.AttestationRules = append(pd.AttestationRules, rule)
+	}
+	for _, inspection := range layout.Inspect {
+		c.warn("inspection %s is not converted as policies cannot run commands", inspection.Name)
+	}
+	c.warn("layout signatures are not verified or carried over, sign the converted policy instead")
+	return pd, c.warnings, nil
+}
+
+func decodeLayout(raw []byte) (*legacyLayout, error) {
+	var mb struct {
+		Signed      json.RawMessage `json:"signed"`
+		PayloadType string          `json:"payloadType"`
+		Payload     string          `json:"payload"`
+	}
+	if err := json.Unmarshal(raw, &mb); err != nil {
+		return nil, err
+	}
+
+	signed := mb.Signed
+	if mb.PayloadType != "" {
+		payload, err := base64.StdEncoding.DecodeString(mb.Payload)
+		if err != nil {
+			if payload, err = base64.URLEncoding.DecodeString(mb.Payload); err != nil {
+				return nil, fmt.Errorf("failed to decode layout envelope payload: %w", err)
+			}
+		}
+		signed = payload
+	} else if signed == nil {
+		return nil, errors.New("layout is neither a signed metablock nor a DSSE envelope")
+	}
+
+	var layout legacyLayout
+	if err := json.Unmarshal(signed, &layout); err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+type layoutConverter struct {
+	layout   *legacyLayout
+	names    map[string]string
+	warnings []string
+}
+
+func (c *layoutConverter) warn(format string, args ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+func (c *layoutConverter) convertStep(step *legacyStep) (*models.AttestationRule, error) {
+	rule := &models.AttestationRule{
+		Name:          step.Name,
+		PredicateType: linkPredicateType,
+	}
+	if step.Threshold > 1 {
+		rule.Threshold = step.Threshold
+	}
+	for _, keyID := range step.PubKeys {
+		name, ok := c.names[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %s", keyID)
+		}
+		rule.AllowedFunctionaries = append(rule.AllowedFunctionaries, name)
+	}
+
+	if len(step.ExpectedCommand) > 0 {
+		args := make([]string, len(step.ExpectedCommand))
+		for i, a := range step.ExpectedCommand {
+			args[i] = strconv.Quote(a)
+		}
+		rule.Policies = append(rule.Policies, &models.Policy{
+			Type: verifiers.PredicateAttributePolicyType,
+			Definition: &models.PredicateAttribute{
+				Expressions: []string{fmt.Sprintf("predicate.command == [%s]", strings.Join(args, ", "))},
+			},
+		})
+		c.warn("step %s: expected_command is now enforced rather than only warned about", step.Name)
+	}
+
+	for _, queue := range []struct {
+		field string
+		rules [][]string
+	}{
+		{materialsField, step.ExpectedMaterials},
+		{productsField, step.ExpectedProducts},
+	} {
+		if len(queue.rules) == 0 && !c.referenced(step.Name, queue.field) {
+			continue
+		}
+		ar := &models.ArtifactRules{Field: queue.field, Rules: []string{}}
+		for _, r := range queue.rules {
+			converted, change, err := c.convertArtifactRule(step.Name, r)
+			if err != nil {
+				return nil, err
+			}
+			if converted == "" {
+				continue
+			}
+			if change {
+				// Legacy CREATE, DELETE and MODIFY compare materials
+				// with products.
+				if queue.field == materialsField {
+					ar.After = productsField
+				} else {
+					ar.Before = materialsField
+				}
+			}
+			ar.Rules = append(ar.Rules, converted)
+		}
+		rule.Policies = append(rule.Policies, &models.Policy{
+			Type:       verifiers.ArtifactRulesPolicyType,
+			Definition: ar,
+		})
+	}
+	return rule, nil
+}
+
+// referenced reports whether a MATCH rule of another step refers to a field
+// of the step, which must then be recorded by an artifact rules policy.
+func (c *layoutConverter) referenced(name, field string) bool {
+	want := "PRODUCTS"
+	if field == materialsField {
+		want = "MATERIALS"
+	}
+	for _, step := range c.layout.Steps {
+		for _, r := range slices.Concat(step.ExpectedMaterials, step.ExpectedProducts) {
+			m, err := parseLegacyMatch(r)
+			if err == nil && m.step == name && m.kind == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// convertArtifactRule converts a legacy artifact rule and reports whether it
+// is a CREATE, DELETE or MODIFY rule. Unconvertible rules are dropped with a
+// warning.
+func (c *layoutConverter) convertArtifactRule(step string, r []string) (string, bool, error) {
+	if len(r) == 0 {
+		return "", false, errors.New("empty artifact rule")
+	}
+	switch keyword := strings.ToUpper(r[0]); keyword {
+	case "CREATE", "DELETE", "MODIFY", "ALLOW", "DISALLOW", "REQUIRE":
+		if len(r) != 2 {
+			return "", false, fmt.Errorf("malformed artifact rule: %s", strings.Join(r, " "))
+		}
+		change := keyword == "CREATE" || keyword == "DELETE" || keyword == "MODIFY"
+		return keyword + " " + strconv.Quote(convertLegacyPattern(r[1])), change, nil
+	case "MATCH":
+		m, err := parseLegacyMatch(r)
+		if err != nil {
+			return "", false, err
+		}
+		if !slices.ContainsFunc(c.layout.Steps, func(s *legacyStep) bool { return s.Name == m.step }) {
+			c.warn("step %s: dropped rule %q as %s is not a step", step, strings.Join(r, " "), m.step)
+			return "", false, nil
+		}
+		field := m.step + ".subject"
+		if m.kind == "MATERIALS" {
+			field = m.step + ".predicate.materials"
+		}
+		rule := "MATCH " + strconv.Quote(convertLegacyPattern(m.pattern))
+		if m.srcPrefix != "" {
+			rule += " IN " + strconv.Quote(m.srcPrefix)
+		}
+		rule += " WITH " + strconv.Quote(field)
+		if m.dstPrefix != "" {
+			rule += " IN " + strconv.Quote(m.dstPrefix)
+		}
+		return rule, false, nil
+	default:
+		return "", false, fmt.Errorf("unknown artifact rule: %s", strings.Join(r, " "))
+	}
+}
+
+type legacyMatch struct {
+	pattern, srcPrefix, kind, dstPrefix, step string
+}
+
+// parseLegacyMatch parses
+// MATCH <pattern> [IN <prefix>] WITH (MATERIALS|PRODUCTS) [IN <prefix>] FROM <step>.
+func parseLegacyMatch(r []string) (*legacyMatch, error) {
+	malformed := fmt.Errorf("malformed match rule: %s", strings.Join(r, " "))
+	if len(r) < 6 || strings.ToUpper(r[0]) != "MATCH" {
+		return nil, malformed
+	}
+	m := &legacyMatch{pattern: r[1]}
+	rest := r[2:]
+	if strings.ToUpper(rest[0]) == "IN" {
+		m.srcPrefix, rest = rest[1], rest[2:]
+	}
+	if len(rest) < 4 || strings.ToUpper(rest[0]) != "WITH" {
+		return nil, malformed
+	}
+	m.kind, rest = strings.ToUpper(rest[1]), rest[2:]
+	if m.kind != "MATERIALS" && m.kind != "PRODUCTS" {
+		return nil, malformed
+	}
+	if strings.ToUpper(rest[0]) == "IN" {
+		if len(rest) < 4 {
+			return nil, malformed
+		}
+		m.dstPrefix, rest = rest[1], rest[2:]
+	}
+	if len(rest) != 2 || strings.ToUpper(rest[0]) != "FROM" {
+		return nil, malformed
+	}
+	m.step = rest[1]
+	return m, nil
+}
+
+// convertLegacyPattern rewrites fnmatch patterns, where * also matches path
+// separators, into globs.
+func convertLegacyPattern(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] != '*' {
+			b.WriteByte(p[i])
+			continue
+		}
+		for i+1 < len(p) && p[i+1] == '*' {
+			i++
+		}
+		b.WriteString("**")
+	}
+	return b.String()
+}
@@ -0,0 +1,221 @@
+package policies
+
+import (
+	"encoding/base64"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+)
+
+const aliceKeyID = "556caebdc0877eed53d419b60eddb1e57fa773e4e31d70698b588f3e9cc48b35"
+
+func convertTestLayout(t *testing.T) (*models.PolicyDocument, []string) {
+	t.Helper()
+	raw, err := os.ReadFile("../../test/data/legacy/root.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd, warnings, err := ConvertLayout(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pd, warnings
+}
+
+// convertedRules returns the artifact rules policy of the attestation rule
+// on field, or nil if there is none.
+func convertedRules(pd *models.PolicyDocument, rule, field string) *models.ArtifactRules {
+	for _, r := range pd.AttestationRules {
+		if r.Name != rule {
+			continue
+		}
+		for _, p := range r.Policies {
+			if ar, ok := p.Definition.(*models.ArtifactRules); ok && ar.Field == field {
+				return ar
+			}
+		}
+	}
+	return nil
+}
+
+func TestConvertLayout(t *testing.T) {
+	pd, warnings := convertTestLayout(t)
+
+	if pd.Expires == nil || !pd.Expires.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expires is %v", pd.Expires)
+	}
+	if len(pd.Functionaries) != 1 || pd.Functionaries[0].Name != "functionary-556caebd" {
+		t.Fatalf("unexpected functionaries: %+v", pd.Functionaries)
+	}
+	if !strings.Contains(pd.Functionaries[0].PublicKey, `"keyid":"`+aliceKeyID+`"`) {
+		t.Errorf("public key does not carry the layout key ID: %s", pd.Functionaries[0].PublicKey)
+	}
+
+	var names []string
+	for _, r := range pd.AttestationRules {
+		names = append(names, r.Name)
+		if r.PredicateType != linkPredicateType {
+			t.Errorf("%s: predicate type is %s", r.Name, r.PredicateType)
+		}
+		if !slices.Equal(r.AllowedFunctionaries, []string{"functionary-556caebd"}) || r.Threshold != 0 {
+			t.Errorf("%s: functionaries %v with threshold %d", r.Name, r.AllowedFunctionaries, r.Threshold)
+		}
+	}
+	if want := []string{"untar", "build_external", "build_main", "build_testy"}; !slices.Equal(names, want) {
+		t.Errorf("attestation rules are %v, want %v", names, want)
+	}
+
+	command := pd.AttestationRules[0].Policies[0]
+	if pa, ok := command.Definition.(*models.PredicateAttribute); command.Type != verifiers.PredicateAttributePolicyType || !ok ||
+		!slices.Equal(pa.Expressions, []string{`predicate.command == ["tar", "xvf", "project.tar.gz"]`}) {
+		t.Errorf("unexpected command policy of untar: %+v", command.Definition)
+	}
+
+	tests := []struct {
+		rule, field   string
+		before, after string
+		rules         []string
+	}{
+		{
+			rule:  "untar",
+			field: materialsField,
+			rules: []string{`ALLOW "project.tar.gz"`, `DISALLOW "**"`},
+		},
+		{
+			rule:   "untar",
+			field:  productsField,
+			before: materialsField,
+			rules: []string{
+				`CREATE "main.c"`, `CREATE "external.c"`, `CREATE "external.h"`,
+				`CREATE "Makefile"`, `CREATE "it.Makefile"`, `DISALLOW "**"`,
+			},
+		},
+		{
+			rule:  "build_testy",
+			field: materialsField,
+			// The MATCH against the package step, which does not exist, is
+			// dropped.
+			rules: []string{
+				`MATCH "main.o" WITH "build_main.subject"`,
+				`MATCH "external.o" WITH "build_external.subject"`,
+				`DISALLOW "**"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		ar := convertedRules(pd, tt.rule, tt.field)
+		if ar == nil {
+			t.Errorf("%s has no artifact rules on %s", tt.rule, tt.field)
+			continue
+		}
+		if ar.Before != tt.before || ar.After != tt.after || !slices.Equal(ar.Rules, tt.rules) {
+			t.Errorf("%s on %s: before %q, after %q, rules %v, want before %q, after %q, rules %v",
+				tt.rule, tt.field, ar.Before, ar.After, ar.Rules, tt.before, tt.after, tt.rules)
+		}
+	}
+
+	for _, want := range []string{
+		"inspection run_testy is not converted as policies cannot run commands",
+		`step build_testy: dropped rule "MATCH * WITH PRODUCTS FROM package" as package is not a step`,
+		"step untar: expected_command is now enforced rather than only warned about",
+		"layout signatures are not verified or carried over, sign the converted policy instead",
+	} {
+		if !slices.Contains(warnings, want) {
+			t.Errorf("missing warning %q in %q", want, warnings)
+		}
+	}
+}
+
+func TestConvertedLayoutVerifies(t *testing.T) {
+	pd, _ := convertTestLayout(t)
+	v, err := NewVerifier(
+		WithKeySource(NewDirectoryKeySource("")),
+		WithAttestationSource(NewDirectoryAttestationSource("../../test/data", nil)),
+		WithVerificationTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.Verify(*pd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed() {
+		for _, ar := range result.AttestationRules {
+			t.Errorf("%s: %s %v", ar.Name, ar.Status, testReasons(result, ar.Name))
+		}
+	}
+}
+
+func TestConvertLayoutVariants(t *testing.T) {
+	keys := `"keys": {
+		"k1": {"keytype": "ed25519", "scheme": "ed25519", "keyval": {"public": "` + strings.Repeat("ab", 32) + `"}},
+		"k2": {"keytype": "ed25519", "scheme": "ed25519", "keyval": {"public": "` + strings.Repeat("cd", 32) + `"}}
+	}`
+	layout := func(steps string) string {
+		return `{"_type": "layout", ` + keys + `, "steps": [` + steps + `], "inspect": []}`
+	}
+	const twoOfTwo = `{"_type": "step", "name": "build", "threshold": 2, "pubkeys": ["k1", "k2"]}`
+
+	tests := []struct {
+		name          string
+		raw           string
+		wantErr       string
+		wantThreshold int
+	}{
+		{
+			name:          "metablock with a threshold",
+			raw:           `{"signed": ` + layout(twoOfTwo) + `, "signatures": []}`,
+			wantThreshold: 2,
+		},
+		{
+			name: "DSSE envelope",
+			raw: `{"payloadType": "application/vnd.in-toto+json", "payload": "` +
+				base64.StdEncoding.EncodeToString([]byte(layout(twoOfTwo))) + `", "signatures": []}`,
+			wantThreshold: 2,
+		},
+		{
+			name:    "unknown step key",
+			raw:     `{"signed": ` + layout(`{"_type": "step", "name": "build", "pubkeys": ["k3"]}`) + `}`,
+			wantErr: "failed to convert step build: unknown key: k3",
+		},
+		{
+			name:    "malformed artifact rule",
+			raw:     `{"signed": ` + layout(`{"_type": "step", "name": "build", "pubkeys": ["k1"], "expected_products": [["ALLOW"]]}`) + `}`,
+			wantErr: "malformed artifact rule: ALLOW",
+		},
+		{
+			name:    "not a layout",
+			raw:     `{"signed": {"_type": "link"}}`,
+			wantErr: "not an in-toto layout: link",
+		},
+		{
+			name:    "neither metablock nor envelope",
+			raw:     `{}`,
+			wantErr: "layout is neither a signed metablock nor a DSSE envelope",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd, _, err := ConvertLayout([]byte(tt.raw))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rule := pd.AttestationRules[0]
+			if rule.Threshold != tt.wantThreshold || !slices.Equal(rule.AllowedFunctionaries, []string{"functionary-k1", "functionary-k2"}) {
+				t.Errorf("threshold %d of %v", rule.Threshold, rule.AllowedFunctionaries)
+			}
+		})
+	}
+}
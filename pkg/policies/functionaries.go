@@ -1,56 +1,56 @@
 package policies
 
 import (
-	"errors"
-	"path/filepath"
+	"time"
 
 	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
-	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
 )
 
-func parseFunctionaries(functionaries []*models.Functionary, dir string) (map[string]dsse.Verifier, error) {
-	sugar.Infof("parsing functionaries")
-	vs := make(map[string]dsse.Verifier, len(functionaries))
+// Functionary provides the verifiers for the signatures a functionary may
+// have made on an attestation. Certificates are checked for validity at the
+// verification time at, unless the functionary has a trusted signing time.
+type Functionary interface {
+	Verifiers(a *Attestation, at time.Time) ([]dsse.Verifier, error)
+}
+
+// keyFunctionary is a functionary identified by a single public key.
+type keyFunctionary struct {
+	dsse.Verifier
+}
+
+func (kf *keyFunctionary) Verifiers(a *Attestation, at time.Time) ([]dsse.Verifier, error) {
+	return []dsse.Verifier{kf.Verifier}, nil
+}
+
+func (vn *verification) parseFunctionaries(functionaries []*models.Functionary, ks KeySource) (map[string]Functionary, error) {
+	vn.sugar.Infof("parsing functionaries")
+	fs := make(map[string]Functionary, len(functionaries))
 	for _, f := range functionaries {
-		v, err := loadPublicKeyVerifier(filepath.Join(dir, f.PublicKeyPath), f.Scheme)
+		fv, err := ks.Functionary(f)
 		if err != nil {
 			return nil, err
 		}
-		keyId, err := v.KeyID()
-		if err != nil {
-			return nil, err
+		if kf, ok := fv.(*keyFunctionary); ok {
+			vn.sugar.Infow("added functionary",
+				"name", f.Name,
+				"keyID", verifierKeyID(kf),
+			)
+		} else {
+			vn.sugar.Infow("added functionary",
+				"name", f.Name,
+			)
 		}
-		sugar.Infow("added functionary",
-			"name", f.Name,
-			"keyID", keyId,
-		)
-		vs[f.Name] = v
+		fs[f.Name] = fv
 	}
-	return vs, nil
+	return fs, nil
 }
 
-func loadPublicKeyVerifier(public_key_path string, scheme string) (dsse.Verifier, error) {
-	switch scheme {
-	case "rsa-pss":
-		rsa, err := signerverifier.LoadRSAPSSKeyFromFile(public_key_path)
-		if err != nil {
-			return nil, err
-		}
-		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(rsa)
-	case "ecdsa":
-		ecdsa, err := signerverifier.LoadECDSAKeyFromFile(public_key_path)
-		if err != nil {
-			return nil, err
-		}
-		return signerverifier.NewECDSASignerVerifierFromSSLibKey(ecdsa)
-	case "ed25519":
-		ed25519, err := signerverifier.LoadED25519KeyFromFile(public_key_path)
-		if err != nil {
-			return nil, err
-		}
-		return signerverifier.NewED25519SignerVerifierFromSSLibKey(ed25519)
-	default:
-		return nil, errors.New("unrecognized scheme")
+// verifierKeyID returns the key ID dsse.EnvelopeVerifier reports for v.
+func verifierKeyID(v dsse.Verifier) string {
+	keyID, err := v.KeyID()
+	if err != nil || keyID == "" {
+		keyID, _ = dsse.SHA256KeyID(v.Public())
 	}
+	return keyID
 }
@@ -0,0 +1,236 @@
+package policies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+// materialFields are the fields holding the inputs of a step, by predicate
+// type.
+var materialFields = map[string]string{
+	"https://in-toto.io/attestation/link/v0.3": "this.predicate.materials",
+	"https://slsa.dev/provenance/v1":           "this.predicate.buildDefinition.resolvedDependencies",
+}
+
+type generatedStep struct {
+	name      string
+	statement *ita.Statement
+	keyIDs    []string
+	consumes  []string
+}
+
+// GeneratePolicy infers a starter policy document from the attestations of
+// a supply chain, grouped into steps like attestation rules find them by
+// file name. Each step requires exactly the subjects it attested, matches
+// its materials with the subjects of the steps that produced them, and pins
+// the command of link predicates. The public key paths of the functionaries
+// are placeholders named after the key IDs that signed the attestations.
+func GeneratePolicy(ctx context.Context, as AttestationSource) (*models.PolicyDocument, error) {
+	attestations, err := as.Attestations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := mapAttestations(attestations)
+	if len(byName) == 0 {
+		return nil, errors.New("no attestations found")
+	}
+
+	var steps []*generatedStep
+	for name, candidates := range byName {
+		slices.SortFunc(candidates, func(a, b *Attestation) int { return strings.Compare(a.Name, b.Name) })
+		a := candidates[0]
+		if a.Envelope.PayloadType != inTotoPayloadType {
+			continue
+		}
+		s, err := getStatement(a.Envelope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse statement of %s: %w", a.Name, err)
+		}
+		step := &generatedStep{name: name, statement: s}
+		for _, sig := range a.Envelope.Signatures {
+			if !slices.Contains(step.keyIDs, sig.KeyID) {
+				step.keyIDs = append(step.keyIDs, sig.KeyID)
+			}
+		}
+		steps = append(steps, step)
+	}
+	slices.SortFunc(steps, func(a, b *generatedStep) int { return strings.Compare(a.name, b.name) })
+
+	pd := &models.PolicyDocument{}
+	functionaries := make(map[string]bool)
+	for _, step := range steps {
+		rule, err := generateRule(step, steps)
+		if err != nil {
+			return nil, err
+		}
+		for _, keyID := range step.keyIDs {
+			name := functionaryName(keyID)
+			rule.AllowedFunctionaries = append(rule.AllowedFunctionaries, name)
+			if !functionaries[name] {
+				functionaries[name] = true
+				pd.Functionaries = append(pd.Functionaries, &models.Functionary{
+					Name:          name,
+					PublicKeyPath: name + ".pub",
+				})
+			}
+		}
+		pd.AttestationRules = append(pd.AttestationRules, rule)
+	}
+	pd.AttestationRules = orderRules(pd.AttestationRules, steps)
+	return pd, nil
+}
+
+func functionaryName(keyID string) string {
+	if len(keyID) > 8 {
+		keyID = keyID[:8]
+	}
+	if keyID == "" {
+		keyID = "unknown"
+	}
+	return "functionary-" + keyID
+}
+
+func generateRule(step *generatedStep, steps []*generatedStep) (*models.AttestationRule, error) {
+	s := step.statement
+	rule := &models.AttestationRule{
+		Name:          step.name,
+		PredicateType: s.PredicateType,
+	}
+
+	if command, ok := s.Predicate.GetFields()["command"]; ok && command.GetListValue() != nil {
+		var args []string
+		for _, v := range command.GetListValue().Values {
+			args = append(args, strconv.Quote(v.GetStringValue()))
+		}
+		rule.Policies = append(rule.Policies, &models.Policy{
+			Type: verifiers.PredicateAttributePolicyType,
+			Definition: &models.PredicateAttribute{
+				Expressions: []string{fmt.Sprintf("predicate.command == [%s]", strings.Join(args, ", "))},
+			},
+		})
+	}
+
+	if field, ok := materialFields[s.PredicateType]; ok {
+		rules, consumes, err := materialRules(s, field, step, steps)
+		if err != nil {
+			return nil, err
+		}
+		step.consumes = consumes
+		rule.Policies = append(rule.Policies, &models.Policy{
+			Type:       verifiers.ArtifactRulesPolicyType,
+			Definition: &models.ArtifactRules{Field: field, Rules: rules},
+		})
+	}
+
+	var rules []string
+	for _, rd := range s.Subject {
+		rules = append(rules, "REQUIRE "+quoteGlob(rd.Name))
+	}
+	rule.Policies = append(rule.Policies, &models.Policy{
+		Type: verifiers.ArtifactRulesPolicyType,
+		Definition: &models.ArtifactRules{
+			Field: "this.subject",
+			Rules: append(rules, `DISALLOW "**"`),
+		},
+	})
+	return rule, nil
+}
+
+// materialRules matches every material with the subject of another step
+// that has the same digest, by name if the names agree. Materials no step
+// produced are allowed by name.
+func materialRules(s *ita.Statement, field string, step *generatedStep, steps []*generatedStep) ([]string, []string, error) {
+	materials, err := verifiers.ResourceDescriptors(s, field)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rules, consumes []string
+	for _, m := range materials {
+		rule := "ALLOW " + quoteGlob(m.Name)
+		for _, producer := range steps {
+			if producer == step {
+				continue
+			}
+			i := slices.IndexFunc(producer.statement.Subject, func(rd *ita.ResourceDescriptor) bool {
+				return sameDigest(rd.Digest, m.Digest)
+			})
+			if i < 0 {
+				continue
+			}
+			rule = fmt.Sprintf("MATCH %s WITH %s", quoteGlob(m.Name), strconv.Quote(producer.name+".subject"))
+			if producer.statement.Subject[i].Name != m.Name {
+				rule += " ON digest"
+			}
+			if !slices.Contains(consumes, producer.name) {
+				consumes = append(consumes, producer.name)
+			}
+			break
+		}
+		rules = append(rules, rule)
+	}
+	return append(rules, `DISALLOW "**"`), consumes, nil
+}
+
+// quoteGlob quotes an artifact name as a pattern that only matches the name.
+func quoteGlob(name string) string {
+	return strconv.Quote(verifiers.EscapeGlob(name))
+}
+
+func sameDigest(d1, d2 map[string]string) bool {
+	common := false
+	for alg, v1 := range d1 {
+		if alg == "md5" || alg == "sha1" {
+			continue
+		}
+		if v2, ok := d2[alg]; ok {
+			if v1 != v2 {
+				return false
+			}
+			common = true
+		}
+	}
+	return common
+}
+
+// orderRules sorts the rules so that producers come before the steps that
+// consume their subjects, keeping the name order otherwise.
+func orderRules(rules []*models.AttestationRule, steps []*generatedStep) []*models.AttestationRule {
+	placed := make(map[string]bool, len(rules))
+	ordered := make([]*models.AttestationRule, 0, len(rules))
+	for len(ordered) < len(rules) {
+		progress := false
+		for i, step := range steps {
+			if placed[step.name] {
+				continue
+			}
+			ready := true
+			for _, c := range step.consumes {
+				ready = ready && placed[c]
+			}
+			if ready {
+				placed[step.name] = true
+				ordered = append(ordered, rules[i])
+				progress = true
+			}
+		}
+		if !progress {
+			// Steps consuming each other's subjects keep their name order.
+			for i, step := range steps {
+				if !placed[step.name] {
+					placed[step.name] = true
+					ordered = append(ordered, rules[i])
+				}
+			}
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,53 @@
+package policies
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+type staticAttestationSource []*Attestation
+
+func (s staticAttestationSource) Attestations(ctx context.Context) ([]*Attestation, error) {
+	return s, nil
+}
+
+func TestGeneratePolicyEscapesArtifactNames(t *testing.T) {
+	digest := `{"sha256":"` + strings.Repeat("a", 64) + `"}`
+	payload := `{"_type":"https://in-toto.io/Statement/v1",` +
+		`"subject":[{"name":"out/*.o","digest":` + digest + `}],` +
+		`"predicateType":"https://in-toto.io/attestation/link/v0.3",` +
+		`"predicate":{"name":"build","materials":[{"name":"src/[a]?.c","digest":` + digest + `}]}}`
+	a := &Attestation{
+		Name: "build.abcdef12.link",
+		Envelope: &dsse.Envelope{
+			PayloadType: inTotoPayloadType,
+			Payload:     base64.StdEncoding.EncodeToString([]byte(payload)),
+			Signatures:  []dsse.Signature{{KeyID: "abcdef1234"}},
+		},
+	}
+
+	pd, err := GeneratePolicy(context.Background(), staticAttestationSource{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []string
+	for _, p := range pd.AttestationRules[0].Policies {
+		if ar, ok := p.Definition.(*models.ArtifactRules); ok {
+			rules = append(rules, ar.Rules...)
+			if ar.Rules[len(ar.Rules)-1] != `DISALLOW "**"` {
+				t.Errorf("artifact rules of %s do not end with DISALLOW \"**\": %v", ar.Field, ar.Rules)
+			}
+		}
+	}
+	for _, want := range []string{`ALLOW "src/\\[a]\\?.c"`, `REQUIRE "out/\\*.o"`} {
+		if !slices.Contains(rules, want) {
+			t.Errorf("missing rule %s in %v", want, rules)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package policies
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+)
+
+// ruleGraph records which attestation rules and sub-policies each rule
+// depends on, derived from the MATCH targets and CEL identifiers used in its
+// policies. Sub-policies are verified before any rule, so they only appear
+// as dependencies.
+type ruleGraph struct {
+	rules        []*models.AttestationRule
+	dependencies map[string][]string
+	subPolicies  map[string][]string
+}
+
+func buildRuleGraph(rules []*models.AttestationRule, subPolicies []*models.SubPolicy) (*ruleGraph, error) {
+	g := &ruleGraph{
+		rules:        rules,
+		dependencies: make(map[string][]string, len(rules)),
+		subPolicies:  make(map[string][]string),
+	}
+	for _, r := range rules {
+		if _, ok := g.dependencies[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate attestation rule name: %s", r.Name)
+		}
+		g.dependencies[r.Name] = nil
+	}
+	namespaces := make(map[string]bool, len(subPolicies))
+	for _, sp := range subPolicies {
+		switch {
+		case sp.Name == "" || sp.Name == "this" || sp.Name == "predicate" || sp.Name == "params" || strings.Contains(sp.Name, "."):
+			return nil, fmt.Errorf("invalid sub-policy name: %q", sp.Name)
+		case namespaces[sp.Name]:
+			return nil, fmt.Errorf("duplicate sub-policy name: %s", sp.Name)
+		}
+		if _, ok := g.dependencies[sp.Name]; ok {
+			return nil, fmt.Errorf("sub-policy and attestation rule share a name: %s", sp.Name)
+		}
+		namespaces[sp.Name] = true
+	}
+
+	for _, r := range rules {
+		var deps, sps []string
+		for _, p := range r.Policies {
+			names, err := verifiers.PolicyReferences(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get references of attestation rule %s: %w", r.Name, err)
+			}
+			for _, n := range names {
+				if _, ok := g.dependencies[n]; ok && n != r.Name && !slices.Contains(deps, n) {
+					deps = append(deps, n)
+				}
+				if namespaces[n] && !slices.Contains(sps, n) {
+					sps = append(sps, n)
+				}
+			}
+		}
+		g.dependencies[r.Name] = deps
+		g.subPolicies[r.Name] = sps
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("attestation rules form a dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return g, nil
+}
+
+func (g *ruleGraph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.rules))
+	var path []string
+
+	var visit func(string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			i := slices.Index(path, name)
+			return append(slices.Clone(path[i:]), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range g.dependencies[name] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, r := range g.rules {
+		if cycle := visit(r.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
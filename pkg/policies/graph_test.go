@@ -0,0 +1,113 @@
+package policies
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+)
+
+// testRule returns an attestation rule whose expressions refer to each of
+// the given names.
+func testRule(name string, refs ...string) *models.AttestationRule {
+	expressions := make([]any, len(refs))
+	for i, ref := range refs {
+		expressions[i] = ref + ".predicateType != ''"
+	}
+	return &models.AttestationRule{
+		Name: name,
+		Policies: []*models.Policy{{
+			Type:       verifiers.PredicateAttributePolicyType,
+			Definition: map[string]any{"expressions": expressions},
+		}},
+	}
+}
+
+func TestBuildRuleGraph(t *testing.T) {
+	rules := []*models.AttestationRule{
+		testRule("package", "build", "test"),
+		testRule("build", "fetch"),
+		testRule("test", "build", "fetch", "vendor"),
+		testRule("fetch"),
+	}
+	subPolicies := []*models.SubPolicy{{Name: "vendor"}}
+
+	g, err := buildRuleGraph(rules, subPolicies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		"package": {"build", "test"},
+		"build":   {"fetch"},
+		"test":    {"build", "fetch"},
+		"fetch":   nil,
+	} {
+		if got := g.dependencies[name]; !slices.Equal(got, want) {
+			t.Errorf("dependencies of %s are %v, want %v", name, got, want)
+		}
+	}
+	if got := g.subPolicies["test"]; !slices.Equal(got, []string{"vendor"}) {
+		t.Errorf("sub-policies of test are %v, want [vendor]", got)
+	}
+}
+
+func TestBuildRuleGraphErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []*models.AttestationRule
+		subPolicies []*models.SubPolicy
+		wantErr     string
+	}{
+		{
+			name:    "cycle",
+			rules:   []*models.AttestationRule{testRule("a", "b"), testRule("b", "c"), testRule("c", "a")},
+			wantErr: "attestation rules form a dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name:    "cycle below an acyclic rule",
+			rules:   []*models.AttestationRule{testRule("a", "b"), testRule("b", "c"), testRule("c", "b")},
+			wantErr: "attestation rules form a dependency cycle: b -> c -> b",
+		},
+		{
+			name:    "duplicate rule",
+			rules:   []*models.AttestationRule{testRule("a"), testRule("a")},
+			wantErr: "duplicate attestation rule name: a",
+		},
+		{
+			name:        "sub-policy named after a rule",
+			rules:       []*models.AttestationRule{testRule("a")},
+			subPolicies: []*models.SubPolicy{{Name: "a"}},
+			wantErr:     "sub-policy and attestation rule share a name: a",
+		},
+		{
+			name:        "reserved sub-policy name",
+			subPolicies: []*models.SubPolicy{{Name: "this"}},
+			wantErr:     `invalid sub-policy name: "this"`,
+		},
+		{
+			name:        "sub-policy named after the parameters",
+			subPolicies: []*models.SubPolicy{{Name: "params"}},
+			wantErr:     `invalid sub-policy name: "params"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildRuleGraph(tt.rules, tt.subPolicies)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBuildRuleGraphSelfReference(t *testing.T) {
+	g, err := buildRuleGraph([]*models.AttestationRule{testRule("a", "a")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deps := g.dependencies["a"]; len(deps) != 0 {
+		t.Errorf("a rule referring to itself depends on %v", deps)
+	}
+}
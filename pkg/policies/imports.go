@@ -0,0 +1,109 @@
+package policies
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	"gopkg.in/yaml.v3"
+)
+
+// resolveImports loads the policy libraries imported by the document at
+// path and replaces the policy refs and INCLUDE rules of its attestation
+// rules with what they name.
+func resolveImports(pd *models.PolicyDocument, path string) error {
+	libraries := make(map[string]*models.PolicyLibrary, len(pd.Imports))
+	ruleSets := make(map[string][]string)
+	for _, imp := range pd.Imports {
+		switch {
+		case imp.Name == "" || strings.Contains(imp.Name, "."):
+			return fmt.Errorf("invalid import name: %q", imp.Name)
+		case libraries[imp.Name] != nil:
+			return fmt.Errorf("duplicate import name: %s", imp.Name)
+		case imp.Path == "":
+			return fmt.Errorf("import %s has no path", imp.Name)
+		}
+		raw, err := readPinned(relativePath(path, imp.Path), imp.Digest)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", imp.Name, err)
+		}
+		library := &models.PolicyLibrary{}
+		if err := yaml.Unmarshal(raw, library); err != nil {
+			return fmt.Errorf("failed to parse import %s: %w", imp.Name, err)
+		}
+		libraries[imp.Name] = library
+		for name, rules := range library.RuleSets {
+			ruleSets[imp.Name+"."+name] = rules
+		}
+	}
+
+	rules := make([]*models.AttestationRule, len(pd.AttestationRules))
+	for i, r := range pd.AttestationRules {
+		rule := *r
+		rule.Policies = make([]*models.Policy, len(r.Policies))
+		for j, p := range r.Policies {
+			var err error
+			if p.Ref != "" {
+				if p, err = resolvePolicyRef(p, libraries); err != nil {
+					return fmt.Errorf("attestation rule %s: %w", r.Name, err)
+				}
+			}
+			if p, err = verifiers.ExpandIncludes(p, ruleSets); err != nil {
+				return fmt.Errorf("attestation rule %s: %w", r.Name, err)
+			}
+			rule.Policies[j] = p
+		}
+		rules[i] = &rule
+	}
+	pd.AttestationRules = rules
+	return nil
+}
+
+// resolvePolicyRef returns the imported policy a policy refers to, with the
+// keys of its local definition overriding the imported ones.
+func resolvePolicyRef(p *models.Policy, libraries map[string]*models.PolicyLibrary) (*models.Policy, error) {
+	ns, name, ok := strings.Cut(p.Ref, ".")
+	library := libraries[ns]
+	if !ok || library == nil {
+		return nil, fmt.Errorf("policy ref does not name an import: %s", p.Ref)
+	}
+	imported, ok := library.Policies[name]
+	if !ok {
+		return nil, fmt.Errorf("import %s has no policy %s", ns, name)
+	}
+	if imported.Ref != "" {
+		return nil, fmt.Errorf("imported policy %s cannot refer to another policy", p.Ref)
+	}
+	if p.Type != "" && p.Type != imported.Type {
+		return nil, fmt.Errorf("policy type %s does not match imported policy %s of type %s", p.Type, p.Ref, imported.Type)
+	}
+
+	definition, err := definitionMap(imported.Definition)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := definitionMap(p.Definition)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(definition, overrides)
+	return &models.Policy{Type: imported.Type, Definition: definition}, nil
+}
+
+func definitionMap(definition any) (map[string]any, error) {
+	m := make(map[string]any)
+	if definition == nil {
+		return m, nil
+	}
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("policy definition is not a mapping: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,324 @@
+package policies
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+)
+
+// loadPublicKeyVerifier loads an sslib JSON key, a PEM or DER encoded
+// public key or certificate, or a JWK. An empty scheme is detected from the
+// key type.
+func loadPublicKeyVerifier(data []byte, scheme string) (dsse.Verifier, error) {
+	var probe struct {
+		KeyType string `json:"keytype"`
+		Kty     string `json:"kty"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.KeyType != "" {
+		return loadSSLibKeyVerifier(data, scheme)
+	}
+
+	var pub crypto.PublicKey
+	var err error
+	if probe.Kty != "" {
+		pub, err = parseJWK(data)
+	} else {
+		pub, err = parsePublicKey(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(pub, scheme); err != nil {
+		return nil, err
+	}
+	keyID, err := sslibKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return newPublicKeyVerifier(pub, keyID)
+}
+
+func loadSSLibKeyVerifier(data []byte, scheme string) (dsse.SignerVerifier, error) {
+	key, err := signerverifier.LoadKeyFromSSLibBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if scheme != "" && schemeForKeyType(key.KeyType) != scheme {
+		return nil, fmt.Errorf("scheme %s does not match key type %s", scheme, key.KeyType)
+	}
+	switch key.KeyType {
+	case signerverifier.RSAKeyType:
+		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(key)
+	case signerverifier.ECDSAKeyType, "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384":
+		return signerverifier.NewECDSASignerVerifierFromSSLibKey(key)
+	case signerverifier.ED25519KeyType:
+		return signerverifier.NewED25519SignerVerifierFromSSLibKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", key.KeyType)
+	}
+}
+
+// LoadSigner loads a private key to sign with, either as an sslib JSON key or
+// as a PKCS8, PKCS1 or EC PEM private key.
+func LoadSigner(data []byte) (dsse.SignerVerifier, error) {
+	var probe struct {
+		KeyType string `json:"keytype"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.KeyType != "" {
+		return loadSSLibKeyVerifier(data, "")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode private key PEM")
+	}
+	var priv crypto.PrivateKey
+	var err error
+	if priv, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if priv, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if priv, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				return nil, errors.New("failed to parse private key: not a PKCS8, PKCS1 or EC private key")
+			}
+		}
+	}
+
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		key, err := signerverifier.LoadRSAPSSKeyFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(key)
+	case *ecdsa.PrivateKey:
+		keyID, err := sslibKeyID(&k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		key := &signerverifier.SSLibKey{KeyID: keyID}
+		key.KeyVal.Public = string(pemPublicKey(&k.PublicKey))
+		key.KeyVal.Private = string(data)
+		return signerverifier.NewECDSASignerVerifierFromSSLibKey(key)
+	case ed25519.PrivateKey:
+		pub := k.Public().(ed25519.PublicKey)
+		keyID, err := sslibKeyID(pub)
+		if err != nil {
+			return nil, err
+		}
+		key := &signerverifier.SSLibKey{KeyID: keyID}
+		key.KeyVal.Public = hex.EncodeToString(pub)
+		key.KeyVal.Private = hex.EncodeToString(k)
+		return signerverifier.NewED25519SignerVerifierFromSSLibKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", priv)
+	}
+}
+
+func schemeForKeyType(keyType string) string {
+	switch {
+	case keyType == signerverifier.RSAKeyType:
+		return "rsa-pss"
+	case strings.HasPrefix(keyType, signerverifier.ECDSAKeyType):
+		return "ecdsa"
+	case keyType == signerverifier.ED25519KeyType:
+		return "ed25519"
+	default:
+		return ""
+	}
+}
+
+func checkScheme(pub crypto.PublicKey, scheme string) error {
+	if scheme == "" {
+		return nil
+	}
+	var want string
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		want = "rsa-pss"
+	case *ecdsa.PublicKey:
+		want = "ecdsa"
+	case ed25519.PublicKey:
+		want = "ed25519"
+	}
+	switch scheme {
+	case "rsa-pss", "ecdsa", "ed25519":
+	default:
+		return errors.New("unrecognized scheme")
+	}
+	if scheme != want {
+		return fmt.Errorf("scheme %s does not match key type %T", scheme, pub)
+	}
+	return nil
+}
+
+// parsePublicKey parses a PEM or DER encoded public key or certificate.
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			return cert.PublicKey, nil
+		}
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return pub, nil
+	}
+	if pub, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return pub, nil
+	}
+	return nil, errors.New("failed to parse public key: not a PKIX or PKCS1 public key")
+}
+
+func parseJWK(data []byte) (crypto.PublicKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+	field := func(s string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := field(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := field(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported JWK curve: %s", jwk.Crv)
+		}
+		x, err := field(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := field(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("JWK point is not on its curve")
+		}
+		return pub, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK curve: %s", jwk.Crv)
+		}
+		x, err := field(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 JWK")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWK key type: %s", jwk.Kty)
+	}
+}
+
+// sslibKeyID computes the key ID securesystemslib would give the key, so
+// signatures made with in-toto tooling keep matching.
+func sslibKeyID(pub crypto.PublicKey) (string, error) {
+	key := map[string]any{
+		"keyid_hash_algorithms": signerverifier.KeyIDHashAlgorithms,
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		sslibKey, err := signerverifier.LoadRSAPSSKeyFromBytes(pemPublicKey(k))
+		if err != nil {
+			return "", err
+		}
+		return sslibKey.KeyID, nil
+	case *ecdsa.PublicKey:
+		key["keytype"] = signerverifier.ECDSAKeyType
+		key["scheme"] = fmt.Sprintf("ecdsa-sha2-nistp%d", k.Curve.Params().BitSize)
+		key["keyval"] = map[string]string{"public": strings.TrimSpace(string(pemPublicKey(k)))}
+	case ed25519.PublicKey:
+		key["keytype"] = signerverifier.ED25519KeyType
+		key["scheme"] = signerverifier.ED25519KeyType
+		key["keyval"] = map[string]string{"public": hex.EncodeToString(k)}
+	default:
+		return "", fmt.Errorf("unsupported public key type: %T", pub)
+	}
+	canonical, err := cjson.EncodeCanonical(key)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(canonical)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func pemPublicKey(pub crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: signerverifier.PublicKeyPEM, Bytes: der})
+}
+
+// newPublicKeyVerifier returns a verifier for a bare public key. RSA keys are
+// expected to sign with RSA-PSS, like sslib keys.
+func newPublicKeyVerifier(pub crypto.PublicKey, keyID string) (dsse.Verifier, error) {
+	key := &signerverifier.SSLibKey{KeyID: keyID}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		key.KeyVal.Public = hex.EncodeToString(k)
+		return signerverifier.NewED25519SignerVerifierFromSSLibKey(key)
+	case *rsa.PublicKey:
+		key.KeyVal.Public = string(pemPublicKey(k))
+		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(key)
+	case *ecdsa.PublicKey:
+		key.KeyVal.Public = string(pemPublicKey(k))
+		return signerverifier.NewECDSASignerVerifierFromSSLibKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported public key type: %T", pub)
+	}
+}
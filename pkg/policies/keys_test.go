@@ -0,0 +1,133 @@
+package policies
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPublicKeyVerifierSSLibKeyID(t *testing.T) {
+	data, err := os.ReadFile("../../test/data/alice.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"", "rsa-pss"} {
+		v, err := loadPublicKeyVerifier(data, scheme)
+		if err != nil {
+			t.Fatalf("scheme %q: %v", scheme, err)
+		}
+		// The links in test/data are signed by alice with this key ID.
+		if keyID, _ := v.KeyID(); !strings.HasPrefix(keyID, "556caebd") {
+			t.Errorf("scheme %q: key ID is %s", scheme, keyID)
+		}
+	}
+	if _, err := loadPublicKeyVerifier(data, "ed25519"); err == nil {
+		t.Error("expected an RSA key to be rejected for the ed25519 scheme")
+	}
+}
+
+func TestLoadPublicKeyVerifierEncodings(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cert := newTestCertificate(t, testLeafTemplate(now.Add(-time.Hour), now.Add(time.Hour)), nil)
+
+	tests := []struct {
+		name   string
+		pub    crypto.PublicKey
+		data   []byte
+		scheme string
+	}{
+		{"ecdsa PEM", &ecKey.PublicKey, pemPublicKey(&ecKey.PublicKey), "ecdsa"},
+		{"ecdsa DER", &ecKey.PublicKey, publicKeyDER(t, ecKey), "ecdsa"},
+		{"ecdsa JWK", &ecKey.PublicKey, testJWK(t, map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+		}), "ecdsa"},
+		{"ed25519 PEM", edPub, pemPublicKey(edPub), "ed25519"},
+		{"ed25519 JWK", edPub, testJWK(t, map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(edPub),
+		}), "ed25519"},
+		{"certificate", cert.cert.PublicKey, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.cert.Raw}), "ecdsa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := sslibKeyID(tt.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The scheme is detected from the key when none is given.
+			for _, scheme := range []string{"", tt.scheme} {
+				v, err := loadPublicKeyVerifier(tt.data, scheme)
+				if err != nil {
+					t.Fatalf("scheme %q: %v", scheme, err)
+				}
+				if keyID, _ := v.KeyID(); keyID != want {
+					t.Errorf("scheme %q: key ID is %s, want %s", scheme, keyID, want)
+				}
+			}
+			if _, err := loadPublicKeyVerifier(tt.data, "rsa-pss"); err == nil {
+				t.Error("expected the key to be rejected for the rsa-pss scheme")
+			}
+		})
+	}
+}
+
+func TestLoadPublicKeyVerifierInvalid(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		scheme  string
+		wantErr string
+	}{
+		{"garbage", []byte("not a key"), "", "failed to parse public key"},
+		{"unknown scheme", pemPublicKey(&ecKey.PublicKey), "dsa", "unrecognized scheme"},
+		{"unsupported JWK", testJWK(t, map[string]string{"kty": "oct"}), "", "unsupported JWK key type: oct"},
+		{"point off its curve", testJWK(t, map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString([]byte{1}),
+			"y":   base64.RawURLEncoding.EncodeToString([]byte{1}),
+		}), "", "JWK point is not on its curve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPublicKeyVerifier(tt.data, tt.scheme)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func testJWK(t *testing.T, fields map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,287 @@
+package policies
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	"gopkg.in/yaml.v3"
+)
+
+// LintError is a problem found in a policy document, located by the line and
+// column of the offending node in its source.
+type LintError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type linter struct {
+	root   *yaml.Node
+	errors []*LintError
+}
+
+// Lint statically checks a YAML or JSON policy document without any
+// functionary keys or attestations. The returned error is only set when the
+// document cannot be decoded at all.
+func Lint(raw []byte) ([]*LintError, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	var pd models.PolicyDocument
+	if err := root.Decode(&pd); err != nil {
+		return nil, err
+	}
+	l := &linter{root: &root}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		l.root = root.Content[0]
+	}
+
+	if pd.Expires != nil && pd.NotBefore != nil && !pd.NotBefore.Before(*pd.Expires) {
+		l.report("notBefore must be before expires", "notBefore")
+	}
+	functionaries := l.lintFunctionaries(pd.Functionaries)
+	namespaces := l.lintSubPolicies(pd.SubPolicies, pd.AttestationRules)
+	params := l.lintParameters(pd.Parameters)
+	imports := l.lintImports(pd.Imports)
+	l.lintAttestationRules(pd.AttestationRules, &verifiers.LintScope{Namespaces: namespaces, Parameters: params, Imports: imports}, functionaries)
+	if len(l.errors) == 0 {
+		if _, err := buildRuleGraph(pd.AttestationRules, pd.SubPolicies); err != nil {
+			l.report(err.Error(), "attestationRules")
+		}
+	}
+
+	slices.SortStableFunc(l.errors, func(a, b *LintError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return l.errors, nil
+}
+
+func (l *linter) lintFunctionaries(functionaries []*models.Functionary) map[string]bool {
+	names := make(map[string]bool, len(functionaries))
+	for i, f := range functionaries {
+		switch {
+		case f.Name == "":
+			l.report("functionary has no name", "functionaries", i)
+		case names[f.Name]:
+			l.report(fmt.Sprintf("duplicate functionary name: %s", f.Name), "functionaries", i, "name")
+		}
+		names[f.Name] = true
+		if f.PublicKeyPath == "" && f.PublicKey == "" && f.Certificate == nil && f.Sigstore == nil {
+			l.report(fmt.Sprintf("functionary %s has no public key, certificate or sigstore identity", f.Name), "functionaries", i)
+		}
+	}
+	return names
+}
+
+func (l *linter) lintSubPolicies(sps []*models.SubPolicy, rules []*models.AttestationRule) []string {
+	var names []string
+	for i, sp := range sps {
+		switch {
+		case sp.Name == "":
+			l.report("sub-policy has no name", "subPolicies", i)
+		case sp.Name == "this" || sp.Name == "predicate" || sp.Name == "params":
+			l.report(fmt.Sprintf("sub-policy name is reserved in expressions: %s", sp.Name), "subPolicies", i, "name")
+		case strings.Contains(sp.Name, "."):
+			l.report(fmt.Sprintf("sub-policy name cannot contain dots: %s", sp.Name), "subPolicies", i, "name")
+		case slices.Contains(names, sp.Name):
+			l.report(fmt.Sprintf("duplicate sub-policy name: %s", sp.Name), "subPolicies", i, "name")
+		case slices.ContainsFunc(rules, func(r *models.AttestationRule) bool { return r.Name == sp.Name }):
+			l.report(fmt.Sprintf("sub-policy and attestation rule share a name: %s", sp.Name), "subPolicies", i, "name")
+		default:
+			names = append(names, sp.Name)
+		}
+		if sp.Path == "" {
+			l.report(fmt.Sprintf("sub-policy %s has no path", sp.Name), "subPolicies", i)
+		}
+		if sp.Digest["sha256"] == "" && sp.Digest["sha512"] == "" {
+			l.report(fmt.Sprintf("sub-policy %s pins no sha256 or sha512 digest", sp.Name), "subPolicies", i)
+		}
+	}
+	return names
+}
+
+// lintParameters checks the declared parameters and returns placeholder
+// values for them.
+func (l *linter) lintParameters(params []*models.Parameter) map[string]any {
+	var names []string
+	for i, p := range params {
+		switch {
+		case !parameterName.MatchString(p.Name):
+			l.report(fmt.Sprintf("invalid parameter name: %q", p.Name), "parameters", i, "name")
+		case slices.Contains(names, p.Name):
+			l.report(fmt.Sprintf("duplicate parameter name: %s", p.Name), "parameters", i, "name")
+		default:
+			names = append(names, p.Name)
+		}
+		switch p.Type {
+		case "", ParameterString, ParameterInt, ParameterBool, ParameterList, ParameterPattern:
+		default:
+			l.report(fmt.Sprintf("unknown parameter type: %s", p.Type), "parameters", i, "type")
+			continue
+		}
+		if p.Default == nil {
+			continue
+		}
+		if _, err := coerceParameter(p, p.Default); err != nil {
+			l.report(fmt.Sprintf("invalid default of parameter %s: %v", p.Name, err), "parameters", i, "default")
+		}
+	}
+	return lintParameterValues(params)
+}
+
+func (l *linter) lintImports(imports []*models.Import) []string {
+	var names []string
+	for i, imp := range imports {
+		switch {
+		case imp.Name == "" || strings.Contains(imp.Name, "."):
+			l.report(fmt.Sprintf("invalid import name: %q", imp.Name), "imports", i)
+		case slices.Contains(names, imp.Name):
+			l.report(fmt.Sprintf("duplicate import name: %s", imp.Name), "imports", i, "name")
+		default:
+			names = append(names, imp.Name)
+		}
+		if imp.Path == "" {
+			l.report(fmt.Sprintf("import %s has no path", imp.Name), "imports", i)
+		}
+		if imp.Digest["sha256"] == "" && imp.Digest["sha512"] == "" {
+			l.report(fmt.Sprintf("import %s pins no sha256 or sha512 digest", imp.Name), "imports", i)
+		}
+	}
+	return names
+}
+
+func (l *linter) lintAttestationRules(rules []*models.AttestationRule, scope *verifiers.LintScope, functionaries map[string]bool) {
+	var names []string
+	fields := make(map[string]bool)
+	for i, r := range rules {
+		switch {
+		case r.Name == "":
+			l.report("attestation rule has no name", "attestationRules", i)
+		case r.Name == "this" || r.Name == "predicate" || r.Name == "params":
+			l.report(fmt.Sprintf("attestation rule name is reserved in expressions: %s", r.Name), "attestationRules", i, "name")
+		case slices.Contains(names, r.Name):
+			l.report(fmt.Sprintf("duplicate attestation rule name: %s", r.Name), "attestationRules", i, "name")
+		default:
+			names = append(names, r.Name)
+		}
+		for _, p := range r.Policies {
+			if p.Ref != "" {
+				scope.Opaque = append(scope.Opaque, r.Name)
+			}
+			if field, ok := verifiers.ArtifactField(p, r.Name); ok {
+				fields[field] = true
+			}
+		}
+	}
+
+	for i, r := range rules {
+		if rulePredicateType(r) == "" {
+			l.report(fmt.Sprintf("attestation rule %s has no predicate type", r.Name), "attestationRules", i)
+		}
+		if r.Match != nil && r.Match.PredicateType != "" && r.PredicateType != "" && r.Match.PredicateType != r.PredicateType {
+			l.report(fmt.Sprintf("match predicate type %s differs from the predicate type of the rule %s", r.Match.PredicateType, r.PredicateType), "attestationRules", i, "match", "predicateType")
+		}
+		if len(r.AllowedFunctionaries) == 0 {
+			l.report(fmt.Sprintf("attestation rule %s allows no functionaries", r.Name), "attestationRules", i)
+		}
+		for j, f := range r.AllowedFunctionaries {
+			if !functionaries[f] {
+				l.report(fmt.Sprintf("unknown functionary: %s", f), "attestationRules", i, "allowedFunctionaries", j)
+			}
+		}
+		if r.Threshold > len(r.AllowedFunctionaries) {
+			l.report(fmt.Sprintf("threshold %d exceeds the %d allowed functionaries", r.Threshold, len(r.AllowedFunctionaries)), "attestationRules", i, "threshold")
+		}
+		if r.Match != nil {
+			l.lintMatch(r.Match, functionaries, "attestationRules", i, "match")
+		}
+
+		scope.Rules = slices.DeleteFunc(slices.Clone(names), func(n string) bool { return n == r.Name })
+		scope.Fields = fields
+		for j, p := range r.Policies {
+			if p.Ref != "" {
+				if ns, _, _ := strings.Cut(p.Ref, "."); !slices.Contains(scope.Imports, ns) {
+					l.report(fmt.Sprintf("policy ref does not name an import: %s", p.Ref), "attestationRules", i, "policies", j, "ref")
+				}
+				continue
+			}
+			for _, issue := range verifiers.LintPolicy(p, r.Name, rulePredicateType(r), scope) {
+				path := []any{"attestationRules", i, "policies", j}
+				for _, k := range strings.Split(issue.Key, ".") {
+					path = append(path, k)
+				}
+				if issue.Index >= 0 {
+					path = append(path, issue.Index)
+				}
+				l.report(issue.Err.Error(), path...)
+			}
+		}
+	}
+}
+
+func (l *linter) lintMatch(m *models.AttestationMatch, functionaries map[string]bool, path ...any) {
+	for j, f := range m.SignedBy {
+		if !functionaries[f] {
+			l.report(fmt.Sprintf("unknown functionary: %s", f), append(path, "signedBy", j)...)
+		}
+	}
+	if m.Selector != "" {
+		if err := verifiers.CheckSelector(m.Selector); err != nil {
+			l.report(err.Error(), append(path, "selector")...)
+		}
+	}
+	if m.OnNone != "" && m.OnNone != "fail" && m.OnNone != "skip" {
+		l.report(fmt.Sprintf("unknown onNone action: %s", m.OnNone), append(path, "onNone")...)
+	}
+	if m.OnMultiple != "" && m.OnMultiple != "fail" && m.OnMultiple != "first" {
+		l.report(fmt.Sprintf("unknown onMultiple action: %s", m.OnMultiple), append(path, "onMultiple")...)
+	}
+}
+
+// report records a problem at the node found by following path, made of
+// mapping keys and sequence indexes, from the document root. Missing nodes
+// fall back to the closest ancestor.
+func (l *linter) report(message string, path ...any) {
+	n := l.root
+	for _, p := range path {
+		next := childNode(n, p)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	l.errors = append(l.errors, &LintError{Line: n.Line, Column: n.Column, Message: message})
+}
+
+func childNode(n *yaml.Node, p any) *yaml.Node {
+	switch p := p.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == p {
+				return n.Content[i+1]
+			}
+		}
+	case int:
+		if n.Kind == yaml.SequenceNode && p < len(n.Content) {
+			return n.Content[p]
+		}
+	default:
+		panic("unexpected path element " + strconv.Quote(fmt.Sprint(p)))
+	}
+	return nil
+}
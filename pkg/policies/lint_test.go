@@ -0,0 +1,179 @@
+package policies
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestLintTestPolicies(t *testing.T) {
+	for _, path := range []string{"../../test/data/policy.yaml", "../../test/data/parameterized-policy.yaml"} {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lintErrors, err := Lint(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range lintErrors {
+			t.Errorf("%s: %v", path, e)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	const functionaries = `functionaries:
+  - name: alice
+    publicKeyPath: ./alice.pub
+`
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "valid",
+			doc: functionaries + `attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.subject
+          rules:
+            - ALLOW "app"
+            - DISALLOW "**"
+  - name: package
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.predicate.materials
+          rules:
+            - MATCH "app" WITH "build.subject"
+            - DISALLOW "**"
+`,
+		},
+		{
+			name: "reserved names",
+			doc: functionaries + `subPolicies:
+  - name: params
+    path: ./params.yaml
+    digest: {sha256: abc}
+attestationRules:
+  - name: this
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+  - name: predicate
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+`,
+			want: []string{
+				"5:11: sub-policy name is reserved in expressions: params",
+				"9:11: attestation rule name is reserved in expressions: this",
+				"12:11: attestation rule name is reserved in expressions: predicate",
+			},
+		},
+		{
+			name: "unknown MATCH targets",
+			doc: functionaries + `attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.subject
+          rules:
+            - MATCH "app" WITH "build.subject"
+            - MATCH "app" WITH "compile.subject"
+            - MISMATCH "app" WITH "package.materials"
+  - name: package
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+`,
+			want: []string{
+				"13:15: attestation rule cannot match with its own artifacts: build.subject",
+				"14:15: artifact field does not name an attestation rule: compile.subject",
+				"15:15: attestation rule package records no artifact field package.materials",
+			},
+		},
+		{
+			name: "bare DISALLOW *",
+			doc: functionaries + `attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.subject
+          rules:
+            - DISALLOW "*.o"
+            - DISALLOW "*"
+`,
+			want: []string{
+				`14:15: DISALLOW "*" is read as DISALLOW "**" and also rejects nested artifacts, write DISALLOW "**" instead`,
+			},
+		},
+		{
+			name: "match predicate type mismatch",
+			doc: functionaries + `attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    match:
+      predicateType: https://slsa.dev/provenance/v1
+  - name: test
+    allowedFunctionaries: [alice]
+    match:
+      predicateType: https://in-toto.io/attestation/test-result/v0.1
+`,
+			want: []string{
+				"9:22: match predicate type https://slsa.dev/provenance/v1 differs from the predicate type of the rule https://in-toto.io/attestation/link/v0.3",
+			},
+		},
+		{
+			name: "unknown functionaries and thresholds",
+			doc: functionaries + `attestationRules:
+  - name: build
+    allowedFunctionaries:
+      - alice
+      - bob
+    threshold: 3
+`,
+			want: []string{
+				"5:5: attestation rule build has no predicate type",
+				"8:9: unknown functionary: bob",
+				"9:16: threshold 3 exceeds the 2 allowed functionaries",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lintErrors, err := Lint([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range lintErrors {
+				got = append(got, e.Error())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lint errors are\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintUndecodable(t *testing.T) {
+	if _, err := Lint([]byte("attestationRules: {")); err == nil {
+		t.Error("expected malformed YAML to fail")
+	}
+	if _, err := Lint([]byte("attestationRules: 1")); err == nil {
+		t.Error("expected a document of the wrong shape to fail")
+	}
+}
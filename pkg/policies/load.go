@@ -0,0 +1,279 @@
+package policies
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PolicyPayloadTypeYAML = "application/vnd.in-toto.policy+yaml"
+	PolicyPayloadTypeJSON = "application/vnd.in-toto.policy+json"
+)
+
+// LoadPolicyDocument reads a YAML or JSON policy document, telling them
+// apart by the file extension. Signed policy documents are refused, they
+// have to be loaded with LoadSignedPolicyDocument.
+func LoadPolicyDocument(path string) (models.PolicyDocument, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	if _, ok := policyEnvelope(raw); ok {
+		return models.PolicyDocument{}, errors.New("policy document is signed, it must be verified against its owners")
+	}
+	payloadType, err := PolicyPayloadType(path)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	pd, err := parsePolicyDocument(raw, payloadType)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	pd.Digest = sha256Digest(raw)
+	return pd, resolvePolicyDocument(&pd, path, nil)
+}
+
+// PolicyPayloadType returns the DSSE payload type of a policy document file
+// by its extension.
+func PolicyPayloadType(path string) (string, error) {
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		return PolicyPayloadTypeYAML, nil
+	case ".json":
+		return PolicyPayloadTypeJSON, nil
+	default:
+		return "", errors.New("unsupported file extension for policy file")
+	}
+}
+
+func parsePolicyDocument(raw []byte, payloadType string) (models.PolicyDocument, error) {
+	pd := models.PolicyDocument{}
+	var err error
+	switch payloadType {
+	case PolicyPayloadTypeYAML:
+		err = yaml.Unmarshal(raw, &pd)
+	case PolicyPayloadTypeJSON:
+		err = json.Unmarshal(raw, &pd)
+	default:
+		err = fmt.Errorf("unsupported policy payload type: %s", payloadType)
+	}
+	return pd, err
+}
+
+func policyEnvelope(raw []byte) (*dsse.Envelope, bool) {
+	var envelope dsse.Envelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, false
+	}
+	return &envelope, strings.HasPrefix(envelope.PayloadType, "application/vnd.in-toto.policy+")
+}
+
+// LoadPolicyTrustRoot reads a YAML or JSON policy trust root. The public
+// keys of its owners are relative to the trust root.
+func LoadPolicyTrustRoot(path string) (*models.PolicyTrustRoot, KeySource, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := &models.PolicyTrustRoot{}
+	if err := yaml.Unmarshal(raw, root); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse policy trust root: %w", err)
+	}
+	return root, NewDirectoryKeySource(filepath.Dir(path)), nil
+}
+
+// LoadSignedPolicyDocument reads a policy document wrapped in a DSSE
+// envelope and only returns it if enough owners of the trust root signed it.
+// Owner certificates are checked at the verification time at, or now if it
+// is zero.
+func LoadSignedPolicyDocument(ctx context.Context, path string, root *models.PolicyTrustRoot, ks KeySource, at time.Time) (models.PolicyDocument, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	envelope, ok := policyEnvelope(raw)
+	if !ok {
+		return models.PolicyDocument{}, errors.New("policy document is not signed")
+	}
+	payload, err := VerifyPolicySignatures(ctx, envelope, root, ks, at)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	pd, err := parsePolicyDocument(payload, envelope.PayloadType)
+	if err != nil {
+		return models.PolicyDocument{}, err
+	}
+	pd.Digest = sha256Digest(raw)
+	return pd, resolvePolicyDocument(&pd, path, nil)
+}
+
+// resolvePolicyDocument resolves the imports and loads the sub-policies of
+// the document at path. parents are the documents referencing path, to
+// reject sub-policies that include themselves.
+func resolvePolicyDocument(pd *models.PolicyDocument, path string, parents []string) error {
+	if err := resolveImports(pd, path); err != nil {
+		return err
+	}
+	return loadSubPolicies(pd, path, parents)
+}
+
+// loadSubPolicies loads the sub-policies of the document at path, relative
+// to it, after checking them against their pinned digests.
+func loadSubPolicies(pd *models.PolicyDocument, path string, parents []string) error {
+	if len(pd.SubPolicies) == 0 {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	parents = append(parents, abs)
+	for _, sp := range pd.SubPolicies {
+		if sp.Path == "" {
+			return fmt.Errorf("sub-policy %s has no path", sp.Name)
+		}
+		subPath := relativePath(path, sp.Path)
+		if abs, err := filepath.Abs(subPath); err == nil && slices.Contains(parents, abs) {
+			return fmt.Errorf("sub-policy %s includes itself: %s", sp.Name, sp.Path)
+		}
+
+		raw, err := readPinned(subPath, sp.Digest)
+		if err != nil {
+			return fmt.Errorf("sub-policy %s: %w", sp.Name, err)
+		}
+		payloadType, err := PolicyPayloadType(subPath)
+		if err != nil {
+			return fmt.Errorf("sub-policy %s: %w", sp.Name, err)
+		}
+		sub, err := parsePolicyDocument(raw, payloadType)
+		if err != nil {
+			return fmt.Errorf("failed to parse sub-policy %s: %w", sp.Name, err)
+		}
+		if err := resolvePolicyDocument(&sub, subPath, parents); err != nil {
+			return fmt.Errorf("sub-policy %s: %w", sp.Name, err)
+		}
+		sp.Policy = &sub
+	}
+	return nil
+}
+
+// relativePath resolves path relative to the document at base.
+func relativePath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(base), path)
+}
+
+// readPinned reads the file at path and checks it against its pinned digest.
+func readPinned(path string, digest map[string]string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigest(raw, digest); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// checkDigest checks data against every sha256 and sha512 digest pinned for
+// it, of which there must be at least one.
+func checkDigest(data []byte, digest map[string]string) error {
+	checked := false
+	for _, alg := range []string{"sha256", "sha512"} {
+		want, ok := digest[alg]
+		if !ok {
+			continue
+		}
+		var got []byte
+		if alg == "sha256" {
+			sum := sha256.Sum256(data)
+			got = sum[:]
+		} else {
+			sum := sha512.Sum512(data)
+			got = sum[:]
+		}
+		if !strings.EqualFold(want, hex.EncodeToString(got)) {
+			return fmt.Errorf("%s digest mismatch: expected %s, got %s", alg, want, hex.EncodeToString(got))
+		}
+		checked = true
+	}
+	if !checked {
+		return errors.New("no sha256 or sha512 digest is pinned")
+	}
+	return nil
+}
+
+// VerifyPolicySignatures checks that the envelope of a policy document is
+// signed by at least threshold distinct owners at the verification time at,
+// or now if it is zero, and returns its payload.
+func VerifyPolicySignatures(ctx context.Context, envelope *dsse.Envelope, root *models.PolicyTrustRoot, ks KeySource, at time.Time) ([]byte, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if len(root.Owners) == 0 {
+		return nil, errors.New("policy trust root has no owners")
+	}
+	threshold := max(root.Threshold, 1)
+	if threshold > len(root.Owners) {
+		return nil, fmt.Errorf("policy threshold %d exceeds the %d owners", threshold, len(root.Owners))
+	}
+
+	owners := make(map[string]Functionary, len(root.Owners))
+	names := make([]string, 0, len(root.Owners))
+	for _, o := range root.Owners {
+		if _, ok := owners[o.Name]; ok {
+			return nil, fmt.Errorf("duplicate policy owner: %s", o.Name)
+		}
+		f, err := ks.Functionary(o)
+		if err != nil {
+			return nil, err
+		}
+		owners[o.Name] = f
+		names = append(names, o.Name)
+	}
+
+	ev, credits, err := buildEnvelopeVerifier(names, owners, &Attestation{Name: "policy", Envelope: envelope}, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build policy verifier from owners: %w", err)
+	}
+	accepted, err := ev.Verify(ctx, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy signature: %w", err)
+	}
+	signers := make(map[string]bool)
+	for _, k := range accepted {
+		signers[credits.functionary(k)] = true
+	}
+	if len(signers) < threshold {
+		return nil, fmt.Errorf("policy signed by %d distinct owners, threshold is %d", len(signers), threshold)
+	}
+	return envelope.DecodeB64Payload()
+}
+
+// SignPolicy wraps a policy document in a DSSE envelope signed by signers.
+func SignPolicy(ctx context.Context, raw []byte, payloadType string, signers ...dsse.Signer) (*dsse.Envelope, error) {
+	if _, err := parsePolicyDocument(raw, payloadType); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+	es, err := dsse.NewEnvelopeSigner(signers...)
+	if err != nil {
+		return nil, err
+	}
+	return es.SignPayload(ctx, payloadType, raw)
+}
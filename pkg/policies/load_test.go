@@ -0,0 +1,157 @@
+package policies
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+const testSignedPolicy = `
+attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+`
+
+// writeSignedPolicy signs the test policy with signers and writes the
+// envelope to a temporary file, returning its path.
+func writeSignedPolicy(t *testing.T, signers ...*testSigner) string {
+	t.Helper()
+	var dsseSigners []dsse.Signer
+	for _, s := range signers {
+		dsseSigners = append(dsseSigners, s.signer)
+	}
+	envelope, err := SignPolicy(context.Background(), []byte(testSignedPolicy), PolicyPayloadTypeYAML, dsseSigners...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSignedPolicyDocument(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	bob := newTestSigner(t, "bob")
+	mallory := newTestSigner(t, "mallory")
+	owners := []*models.Functionary{alice.functionary(), bob.functionary()}
+
+	tests := []struct {
+		name      string
+		signers   []*testSigner
+		threshold int
+		wantErr   string
+	}{
+		{name: "signed by one owner", signers: []*testSigner{alice}, threshold: 1},
+		{name: "signed by both owners", signers: []*testSigner{alice, bob}, threshold: 2},
+		{
+			name:      "threshold not met",
+			signers:   []*testSigner{alice},
+			threshold: 2,
+			wantErr:   "policy signed by 1 distinct owners, threshold is 2",
+		},
+		{
+			name:      "one owner signing twice",
+			signers:   []*testSigner{bob, bob},
+			threshold: 2,
+			wantErr:   "policy signed by 1 distinct owners, threshold is 2",
+		},
+		{
+			name:      "unknown owner",
+			signers:   []*testSigner{mallory},
+			threshold: 1,
+			wantErr:   "failed to verify policy signature",
+		},
+		{
+			name:      "threshold exceeding the owners",
+			signers:   []*testSigner{alice, bob},
+			threshold: 3,
+			wantErr:   "policy threshold 3 exceeds the 2 owners",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSignedPolicy(t, tt.signers...)
+			root := &models.PolicyTrustRoot{Owners: owners, Threshold: tt.threshold}
+			pd, err := LoadSignedPolicyDocument(context.Background(), path, root, NewDirectoryKeySource(""), time.Time{})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			case tt.wantErr == "" && (len(pd.AttestationRules) != 1 || pd.AttestationRules[0].Name != "build"):
+				t.Fatalf("unexpected policy document: %+v", pd)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyDocumentRefusesSignedPolicy(t *testing.T) {
+	path := writeSignedPolicy(t, newTestSigner(t, "alice"))
+	_, err := LoadPolicyDocument(path)
+	if err == nil || !strings.Contains(err.Error(), "policy document is signed") {
+		t.Fatalf("expected a signed policy to be refused, got: %v", err)
+	}
+}
+
+// timedKeySource records the verification times its functionaries are asked
+// for verifiers at.
+type timedKeySource struct {
+	KeySource
+	times []time.Time
+}
+
+func (ks *timedKeySource) Functionary(f *models.Functionary) (Functionary, error) {
+	fv, err := ks.KeySource.Functionary(f)
+	if err != nil {
+		return nil, err
+	}
+	return &timedFunctionary{Functionary: fv, ks: ks}, nil
+}
+
+type timedFunctionary struct {
+	Functionary
+	ks *timedKeySource
+}
+
+func (f *timedFunctionary) Verifiers(a *Attestation, at time.Time) ([]dsse.Verifier, error) {
+	f.ks.times = append(f.ks.times, at)
+	return f.Functionary.Verifiers(a, at)
+}
+
+func TestLoadSignedPolicyDocumentVerificationTime(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	path := writeSignedPolicy(t, alice)
+	root := &models.PolicyTrustRoot{Owners: []*models.Functionary{alice.functionary()}}
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ks := &timedKeySource{KeySource: NewDirectoryKeySource("")}
+	if _, err := LoadSignedPolicyDocument(context.Background(), path, root, ks, at); err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.times) != 1 || !ks.times[0].Equal(at) {
+		t.Errorf("owners were verified at %v, want %v", ks.times, at)
+	}
+
+	ks.times = nil
+	before := time.Now()
+	if _, err := LoadSignedPolicyDocument(context.Background(), path, root, ks, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.times) != 1 || ks.times[0].Before(before) {
+		t.Errorf("owners were verified at %v, want the current time", ks.times)
+	}
+}
@@ -0,0 +1,138 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// findAttestations returns the attestations an attestation rule applies to,
+// or none if nothing matched and the rule allows being skipped. Several
+// attestations are only returned to rules with a threshold above one.
+func (vn *verification) findAttestations(ar *models.AttestationRule) ([]*Attestation, error) {
+	if ar.Match == nil {
+		candidates := vn.attestationsByName[ar.Name]
+		switch {
+		case len(candidates) == 0:
+			return nil, errors.New("could not find matching attestation file")
+		case len(candidates) == 1 || ar.Threshold > 1:
+			return candidates, nil
+		default:
+			return nil, fmt.Errorf("found multiple attestation files for rule, use a match block to select one: %s", attestationNames(candidates))
+		}
+	}
+
+	m := ar.Match
+	if m.PredicateType != "" && ar.PredicateType != "" && m.PredicateType != ar.PredicateType {
+		return nil, fmt.Errorf("match predicate type %s differs from the predicate type of the rule %s", m.PredicateType, ar.PredicateType)
+	}
+	if m.OnNone != "" && m.OnNone != "fail" && m.OnNone != "skip" {
+		return nil, fmt.Errorf("unknown onNone action: %s", m.OnNone)
+	}
+	if m.OnMultiple != "" && m.OnMultiple != "fail" && m.OnMultiple != "first" {
+		return nil, fmt.Errorf("unknown onMultiple action: %s", m.OnMultiple)
+	}
+
+	candidates, err := vn.matchAttestations(ar)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(candidates) == 0 && m.OnNone == "skip":
+		return nil, nil
+	case len(candidates) == 0:
+		return nil, errors.New("no attestation matched the match block")
+	case len(candidates) == 1 || ar.Threshold > 1:
+		return candidates, nil
+	case m.OnMultiple != "first":
+		return nil, fmt.Errorf("multiple attestations matched the match block: %s", attestationNames(candidates))
+	}
+	return candidates[:1], nil
+}
+
+func (vn *verification) matchAttestations(ar *models.AttestationRule) ([]*Attestation, error) {
+	m := ar.Match
+	predicateType := rulePredicateType(ar)
+
+	for _, f := range m.SignedBy {
+		if _, ok := vn.functionaries[f]; !ok {
+			return nil, fmt.Errorf("unknown functionary: %s", f)
+		}
+	}
+
+	var matched []*Attestation
+	for _, a := range vn.attestationList {
+		if a.Envelope.PayloadType != inTotoPayloadType {
+			continue
+		}
+		statement, err := getStatement(a.Envelope)
+		if err != nil || statement.PredicateType != predicateType {
+			continue
+		}
+		if m.Subject != nil && !matchSubject(m.Subject, statement.Subject) {
+			continue
+		}
+		if len(m.SignedBy) > 0 {
+			ev, _, err := buildEnvelopeVerifier(m.SignedBy, vn.functionaries, a, vn.at)
+			if err != nil {
+				continue
+			}
+			if _, err := ev.Verify(vn.ctx, a.Envelope); err != nil {
+				continue
+			}
+		}
+		if m.Selector != "" {
+			ok, err := verifiers.EvaluateSelector(m.Selector, statement)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate selector: %w", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = append(matched, a)
+	}
+	return matched, nil
+}
+
+// rulePredicateType returns the predicate type of the attestations of the
+// rule, which its match block may declare in place of the rule itself.
+func rulePredicateType(ar *models.AttestationRule) string {
+	if ar.PredicateType == "" && ar.Match != nil {
+		return ar.Match.PredicateType
+	}
+	return ar.PredicateType
+}
+
+func matchSubject(sm *models.SubjectMatch, subjects []*ita.ResourceDescriptor) bool {
+	for _, s := range subjects {
+		if sm.Name != "" && sm.Name != s.Name {
+			continue
+		}
+		found := true
+		for alg, d := range sm.Digest {
+			if s.Digest[alg] != d {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func attestationNames(as []*Attestation) string {
+	names := make([]string, len(as))
+	for i, a := range as {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,194 @@
+package policies
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testRuleResult(result *VerificationResult, rule string) *AttestationRuleResult {
+	for _, ar := range result.AttestationRules {
+		if ar.Name == rule {
+			return ar
+		}
+	}
+	return nil
+}
+
+func TestMatchBlock(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	bob := newTestSigner(t, "bob")
+	digest := strings.Repeat("a", 64)
+	otherDigest := strings.Repeat("b", 64)
+
+	named := func(name string, a *Attestation) *Attestation {
+		a.Name = name
+		return a
+	}
+	attestations := []*Attestation{
+		named("first.json", newTestLink(t, "build", nil, testArtifacts{"app": digest}, alice)),
+		named("second.json", newTestLink(t, "test", nil, testArtifacts{"app": otherDigest}, bob)),
+	}
+
+	tests := []struct {
+		name       string
+		match      string
+		wantStatus Status
+		wantFiles  []string
+		wantReason string
+	}{
+		{
+			name:       "selector",
+			match:      "selector: this.predicate.name == 'test'\n",
+			wantStatus: StatusPassed,
+			wantFiles:  []string{"second.json"},
+		},
+		{
+			name:       "signedBy",
+			match:      "signedBy: [alice]\n",
+			wantStatus: StatusPassed,
+			wantFiles:  []string{"first.json"},
+		},
+		{
+			name:       "subject name and digest",
+			match:      "subject:\n  name: app\n  digest:\n    sha256: " + otherDigest + "\n",
+			wantStatus: StatusPassed,
+			wantFiles:  []string{"second.json"},
+		},
+		{
+			name:       "subject digest matching nothing",
+			match:      "subject:\n  digest:\n    sha256: " + strings.Repeat("c", 64) + "\n",
+			wantStatus: StatusFailed,
+			wantReason: "no attestation matched the match block",
+		},
+		{
+			name:       "onNone skip",
+			match:      "selector: this.predicate.name == 'deploy'\nonNone: skip\n",
+			wantStatus: StatusSkipped,
+		},
+		{
+			name:       "onNone fail",
+			match:      "selector: this.predicate.name == 'deploy'\nonNone: fail\n",
+			wantStatus: StatusFailed,
+			wantReason: "no attestation matched the match block",
+		},
+		{
+			name:       "onMultiple first",
+			match:      "onMultiple: first\n",
+			wantStatus: StatusPassed,
+			wantFiles:  []string{"first.json"},
+		},
+		{
+			name:       "onMultiple fail",
+			match:      "onMultiple: fail\n",
+			wantStatus: StatusFailed,
+			wantReason: "multiple attestations matched the match block: first.json, second.json",
+		},
+		{
+			name:       "unknown signer",
+			match:      "signedBy: [mallory]\n",
+			wantStatus: StatusFailed,
+			wantReason: "unknown functionary: mallory",
+		},
+		{
+			name:       "predicate type differing from the rule",
+			match:      "predicateType: https://slsa.dev/provenance/v1\n",
+			wantStatus: StatusFailed,
+			wantReason: "match predicate type https://slsa.dev/provenance/v1 differs from the predicate type of the rule",
+		},
+		{
+			name:       "predicate type equal to the rule",
+			match:      "predicateType: https://in-toto.io/attestation/link/v0.3\nsignedBy: [bob]\n",
+			wantStatus: StatusPassed,
+			wantFiles:  []string{"second.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := `
+attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice, bob]
+    match:
+` + indent(tt.match, "      ")
+			ar := testRuleResult(verifyTestPolicy(t, policy, attestations, alice, bob), "build")
+			if ar.Status != tt.wantStatus {
+				t.Fatalf("status is %s, want %s: %v", ar.Status, tt.wantStatus, ar.Reasons)
+			}
+			if tt.wantFiles != nil && !slices.Equal(ar.AttestationFiles, tt.wantFiles) {
+				t.Errorf("attestation files are %v, want %v", ar.AttestationFiles, tt.wantFiles)
+			}
+			if tt.wantReason != "" && !strings.Contains(strings.Join(ar.Reasons, "\n"), tt.wantReason) {
+				t.Errorf("reasons %v do not contain %q", ar.Reasons, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestMatchBlockPredicateTypeInPlaceOfRule(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	const policy = `
+attestationRules:
+  - name: build
+    allowedFunctionaries: [alice]
+    match:
+      predicateType: https://in-toto.io/attestation/link/v0.3
+`
+	build := newTestLink(t, "build", nil, testArtifacts{"app": strings.Repeat("a", 64)}, alice)
+	if ar := testRuleResult(verifyTestPolicy(t, policy, []*Attestation{build}, alice), "build"); ar.Status != StatusPassed {
+		t.Fatalf("status is %s: %v", ar.Status, ar.Reasons)
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	return prefix + strings.Join(lines, prefix) + "\n"
+}
+
+func TestMatchBlockSkippedDependency(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	digest := strings.Repeat("a", 64)
+	const policy = `
+attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    match:
+      selector: this.predicate.name == 'build'
+      onNone: skip
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.subject
+          rules:
+            - ALLOW "**"
+  - name: package
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.predicate.materials
+          rules:
+            - MATCH "app" WITH "build.subject"
+            - DISALLOW "**"
+`
+	pkg := newTestLink(t, "package", testArtifacts{"app": digest}, testArtifacts{"app.tar": digest}, alice)
+	result := verifyTestPolicy(t, policy, []*Attestation{pkg}, alice)
+	if ar := testRuleResult(result, "build"); ar.Status != StatusSkipped {
+		t.Fatalf("build status is %s, want %s", ar.Status, StatusSkipped)
+	}
+	ar := testRuleResult(result, "package")
+	if ar.Status != StatusFailed || !slices.Contains(ar.Reasons, "depends on skipped attestation rules: build") {
+		t.Fatalf("package status is %s: %v", ar.Status, ar.Reasons)
+	}
+	if result.Passed() {
+		t.Error("expected the policy to fail")
+	}
+
+	build := newTestLink(t, "build", nil, testArtifacts{"app": digest}, alice)
+	if result := verifyTestPolicy(t, policy, []*Attestation{build, pkg}, alice); !result.Passed() {
+		t.Errorf("expected the policy to pass with the build attestation: %v", testReasons(result, "package"))
+	}
+}
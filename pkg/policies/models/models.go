@@ -1,14 +1,120 @@
 package models
 
+import "time"
+
 type PolicyDocument struct {
+	// Expires and NotBefore bound the time in which the policy may approve
+	// anything. Both are optional.
+	Expires          *time.Time         `yaml:"expires,omitempty" json:"expires,omitempty"`
+	NotBefore        *time.Time         `yaml:"notBefore,omitempty" json:"notBefore,omitempty"`
 	Functionaries    []*Functionary     `yaml:"functionaries" json:"functionaries"`
 	AttestationRules []*AttestationRule `yaml:"attestationRules" json:"attestationRules"`
+	SubPolicies      []*SubPolicy       `yaml:"subPolicies,omitempty" json:"subPolicies,omitempty"`
+	Parameters       []*Parameter       `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	Imports          []*Import          `yaml:"imports,omitempty" json:"imports,omitempty"`
+
+	// Digest of the file the document was loaded from, keyed by algorithm.
+	Digest map[string]string `yaml:"-" json:"-"`
+}
+
+// Import loads a policy library into the namespace of Name. Artifact rules
+// include its rule sets with INCLUDE "<name>.<rule set>" and policies refer
+// to its policies with ref: <name>.<policy>.
+type Import struct {
+	Name string `yaml:"name" json:"name"`
+	// Path is relative to the policy document importing it.
+	Path string `yaml:"path" json:"path"`
+	// Digest pins the contents of the file at Path, e.g. by sha256.
+	Digest map[string]string `yaml:"digest" json:"digest"`
+}
+
+// PolicyLibrary holds named fragments shared by policy documents.
+type PolicyLibrary struct {
+	RuleSets map[string][]string `yaml:"ruleSets,omitempty" json:"ruleSets,omitempty"`
+	Policies map[string]*Policy  `yaml:"policies,omitempty" json:"policies,omitempty"`
+}
+
+// Parameter is an input of a policy supplied at verification time. It is
+// available in CEL expressions as params.<name> and substituted for
+// ${<name>} in artifact rules.
+type Parameter struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is one of string (default), int, bool, list, a list of strings, or
+	// pattern, a string whose wildcards are kept when it is substituted into
+	// artifact rules. Other values match literally there.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Default is used when no value is supplied. Parameters without a
+	// default are required.
+	Default     any    `yaml:"default,omitempty" json:"default,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// SubPolicy delegates part of the verification to another policy document,
+// whose attestation rules are verified in the namespace of Name, e.g.
+// frontend.build. The final subjects of the sub-policy are recorded as
+// Name.subject.
+type SubPolicy struct {
+	Name string `yaml:"name" json:"name"`
+	// Path is relative to the policy document referencing it.
+	Path string `yaml:"path" json:"path"`
+	// Digest pins the contents of the file at Path, e.g. by sha256.
+	Digest map[string]string `yaml:"digest" json:"digest"`
+
+	// Policy is the loaded document at Path.
+	Policy *PolicyDocument `yaml:"-" json:"-"`
+}
+
+// PolicyTrustRoot names the owners that sign policy documents.
+type PolicyTrustRoot struct {
+	Owners []*Functionary `yaml:"owners" json:"owners"`
+	// Threshold is the number of distinct owners that must have signed a
+	// policy document, defaulting to one.
+	Threshold int `yaml:"threshold,omitempty" json:"threshold,omitempty"`
 }
 
 type Functionary struct {
 	Name          string `yaml:"name" json:"name"`
-	PublicKeyPath string `yaml:"publicKeyPath" json:"publicKeyPath"`
-	Scheme        string `yaml:"scheme" json:"scheme"`
+	PublicKeyPath string `yaml:"publicKeyPath,omitempty" json:"publicKeyPath,omitempty"`
+	// PublicKey holds the key inline instead of in PublicKeyPath, in any of
+	// the formats accepted there: sslib JSON, PEM or JWK.
+	PublicKey string `yaml:"publicKey,omitempty" json:"publicKey,omitempty"`
+	// Scheme is one of rsa-pss, ecdsa or ed25519 and is detected from the
+	// key when omitted.
+	Scheme string `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+	// Certificate identifies the functionary by certificates issued from a
+	// trust root instead of a fixed public key.
+	Certificate *CertificateConstraints `yaml:"certificate,omitempty" json:"certificate,omitempty"`
+	// Sigstore identifies a keyless functionary by the OIDC identity in its
+	// Fulcio certificate, verified offline from Sigstore bundles.
+	Sigstore *SigstoreIdentity `yaml:"sigstore,omitempty" json:"sigstore,omitempty"`
+}
+
+type SigstoreIdentity struct {
+	Issuer string `yaml:"issuer" json:"issuer"`
+	// Subject is the email address or URI (e.g. a workflow) the certificate
+	// was issued to.
+	Subject         string `yaml:"subject" json:"subject"`
+	TrustedRootPath string `yaml:"trustedRootPath" json:"trustedRootPath"`
+	// RekorPublicKeyPath replaces the transparency logs of the trusted root
+	// with a single Rekor public key, for the Rekor instance at RekorURL.
+	RekorPublicKeyPath string `yaml:"rekorPublicKeyPath,omitempty" json:"rekorPublicKeyPath,omitempty"`
+	RekorURL           string `yaml:"rekorURL,omitempty" json:"rekorURL,omitempty"`
+}
+
+type CertificateConstraints struct {
+	RootsPath         string `yaml:"rootsPath" json:"rootsPath"`
+	IntermediatesPath string `yaml:"intermediatesPath,omitempty" json:"intermediatesPath,omitempty"`
+	CommonName        string `yaml:"commonName,omitempty" json:"commonName,omitempty"`
+	// Each non-empty SAN list requires the certificate to carry at least one
+	// of its values.
+	DNSNames []string `yaml:"dnsNames,omitempty" json:"dnsNames,omitempty"`
+	Emails   []string `yaml:"emails,omitempty" json:"emails,omitempty"`
+	URIs     []string `yaml:"uris,omitempty" json:"uris,omitempty"`
+	// ExtKeyUsages are names such as codeSigning, or dotted OIDs.
+	ExtKeyUsages []string `yaml:"extKeyUsages,omitempty" json:"extKeyUsages,omitempty"`
+	// Extensions maps dotted OIDs to the value the extension must hold. An
+	// empty value only requires the extension to be present.
+	Extensions map[string]string `yaml:"extensions,omitempty" json:"extensions,omitempty"`
 }
 
 type AttestationRule struct {
@@ -16,11 +122,41 @@ type AttestationRule struct {
 	PredicateType        string    `yaml:"predicateType" json:"predicateType"`
 	Policies             []*Policy `yaml:"policies" json:"policies"`
 	AllowedFunctionaries []string  `yaml:"allowedFunctionaries" json:"allowedFunctionaries"`
+	// Threshold is the number of distinct allowed functionaries that must
+	// have signed the attestation, defaulting to one.
+	Threshold int `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	// Match selects attestations by their contents rather than by the
+	// attestation file name starting with the rule name.
+	Match *AttestationMatch `yaml:"match,omitempty" json:"match,omitempty"`
+}
+
+type AttestationMatch struct {
+	// PredicateType stands in for the predicate type of the attestation rule
+	// when the rule has none. It must not differ from the rule's.
+	PredicateType string        `yaml:"predicateType,omitempty" json:"predicateType,omitempty"`
+	SignedBy      []string      `yaml:"signedBy,omitempty" json:"signedBy,omitempty"`
+	Subject       *SubjectMatch `yaml:"subject,omitempty" json:"subject,omitempty"`
+	// Selector is a CEL expression over `this` that must evaluate to true.
+	Selector string `yaml:"selector,omitempty" json:"selector,omitempty"`
+	// OnNone is either "fail" (default) or "skip". Rules that depend on a
+	// skipped rule fail.
+	OnNone string `yaml:"onNone,omitempty" json:"onNone,omitempty"`
+	// OnMultiple is either "fail" (default) or "first".
+	OnMultiple string `yaml:"onMultiple,omitempty" json:"onMultiple,omitempty"`
+}
+
+type SubjectMatch struct {
+	Name   string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Digest map[string]string `yaml:"digest,omitempty" json:"digest,omitempty"`
 }
 
 type Policy struct {
 	Type       string      `yaml:"type" json:"type"`
 	Definition interface{} `yaml:"definition" json:"definition"`
+	// Ref names an imported policy as <import>.<policy>. Type may then be
+	// omitted, and the keys of Definition override those of the imported
+	// definition.
+	Ref string `yaml:"ref,omitempty" json:"ref,omitempty"`
 }
 
 type PredicateAttribute struct {
@@ -31,4 +167,14 @@ type PredicateAttribute struct {
 type ArtifactRules struct {
 	Field string   `yaml:"field" json:"field"`
 	Rules []string `yaml:"rules" json:"rules"`
+	// Before and After are the fields CREATE, DELETE and MODIFY rules
+	// compare, e.g. this.predicate.materials and this.subject. Either one
+	// defaults to Field, and either may name a field recorded by another
+	// attestation rule such as untar.subject.
+	Before string `yaml:"before,omitempty" json:"before,omitempty"`
+	After  string `yaml:"after,omitempty" json:"after,omitempty"`
+	// DigestAlgorithms are the algorithms artifact digests are compared by,
+	// of which two digests must share at least one. md5 and sha1 are never
+	// allowed.
+	DigestAlgorithms []string `yaml:"digestAlgorithms,omitempty" json:"digestAlgorithms,omitempty"`
 }
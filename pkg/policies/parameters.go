@@ -0,0 +1,196 @@
+package policies
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ParameterString  = "string"
+	ParameterInt     = "int"
+	ParameterBool    = "bool"
+	ParameterList    = "list"
+	ParameterPattern = "pattern"
+)
+
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadParameters reads parameter values from a YAML or JSON mapping of
+// parameter names to values.
+func LoadParameters(path string) (map[string]any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any)
+	if err := yaml.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters: %w", err)
+	}
+	return values, nil
+}
+
+// checkParameters rejects values for parameters that neither the policy nor
+// any of its sub-policies declares.
+func checkParameters(pd models.PolicyDocument, values map[string]any) error {
+	declared := make(map[string]bool)
+	var collect func(pd *models.PolicyDocument)
+	collect = func(pd *models.PolicyDocument) {
+		for _, p := range pd.Parameters {
+			declared[p.Name] = true
+		}
+		for _, sp := range pd.SubPolicies {
+			if sp.Policy != nil {
+				collect(sp.Policy)
+			}
+		}
+	}
+	collect(&pd)
+
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("unknown policy parameters: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// resolveParameters returns the value of every declared parameter, taken
+// from values or its default, converted to its type. Values of undeclared
+// parameters are ignored.
+func resolveParameters(declared []*models.Parameter, values map[string]any) (map[string]any, error) {
+	resolved := make(map[string]any, len(declared))
+	for _, p := range declared {
+		if !parameterName.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name: %q", p.Name)
+		}
+		if _, ok := resolved[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate parameter name: %s", p.Name)
+		}
+		v, ok := values[p.Name]
+		if !ok {
+			v = p.Default
+		}
+		if v == nil {
+			return nil, fmt.Errorf("no value for required parameter: %s", p.Name)
+		}
+		value, err := coerceParameter(p, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %s: %w", p.Name, err)
+		}
+		resolved[p.Name] = value
+	}
+	return resolved, nil
+}
+
+// coerceParameter converts v to the type of the parameter. Strings, as
+// given on the command line, are parsed, with lists separated by commas.
+func coerceParameter(p *models.Parameter, v any) (any, error) {
+	switch p.Type {
+	case "", ParameterString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case int, bool, float64:
+			return fmt.Sprint(v), nil
+		}
+	case ParameterPattern:
+		if v, ok := v.(string); ok {
+			return verifiers.PatternParameter(v), nil
+		}
+	case ParameterInt:
+		switch v := v.(type) {
+		case int:
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case ParameterBool:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case ParameterList:
+		switch v := v.(type) {
+		case string:
+			if v == "" {
+				return []string{}, nil
+			}
+			return strings.Split(v, ","), nil
+		case []any:
+			list := make([]string, len(v))
+			for i, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("list element %v is not a string", e)
+				}
+				list[i] = s
+			}
+			return list, nil
+		case []string:
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown parameter type: %s", p.Type)
+	}
+	return nil, fmt.Errorf("%v is not of type %s", v, p.Type)
+}
+
+// applyParameters returns a copy of the policy document with parameters
+// substituted in the rules of its artifact rules policies.
+func applyParameters(pd models.PolicyDocument, params map[string]any) (models.PolicyDocument, error) {
+	rules := make([]*models.AttestationRule, len(pd.AttestationRules))
+	for i, r := range pd.AttestationRules {
+		rule := *r
+		rule.Policies = make([]*models.Policy, len(r.Policies))
+		for j, p := range r.Policies {
+			policy, err := verifiers.SubstituteParameters(p, params)
+			if err != nil {
+				return pd, fmt.Errorf("attestation rule %s: %w", r.Name, err)
+			}
+			rule.Policies[j] = policy
+		}
+		rules[i] = &rule
+	}
+	pd.AttestationRules = rules
+	return pd, nil
+}
+
+// lintParameterValues returns placeholder values of the declared parameters, by
+// their defaults where valid, to statically check the policies using them.
+func lintParameterValues(declared []*models.Parameter) map[string]any {
+	values := make(map[string]any, len(declared))
+	for _, p := range declared {
+		if v, err := coerceParameter(p, p.Default); err == nil && p.Default != nil {
+			values[p.Name] = v
+			continue
+		}
+		switch p.Type {
+		case ParameterInt:
+			values[p.Name] = int64(0)
+		case ParameterBool:
+			values[p.Name] = false
+		case ParameterList:
+			values[p.Name] = []string{}
+		case ParameterPattern:
+			values[p.Name] = verifiers.PatternParameter(p.Name)
+		default:
+			values[p.Name] = p.Name
+		}
+	}
+	return values
+}
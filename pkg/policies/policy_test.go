@@ -0,0 +1,11 @@
+package policies_test
+
+import (
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/policytest"
+)
+
+func TestPolicies(t *testing.T) {
+	policytest.Check(t, "../../test/data/policy-tests.yaml")
+}
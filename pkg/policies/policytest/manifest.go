@@ -0,0 +1,94 @@
+// Package policytest runs policy documents against fixtures of attestations
+// and checks that each one passes or fails as expected.
+package policytest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest lists the test cases of one or more policies. Paths are relative
+// to the manifest.
+type Manifest struct {
+	Name  string  `yaml:"name"`
+	Cases []*Case `yaml:"cases"`
+
+	dir string
+}
+
+type Case struct {
+	Name   string `yaml:"name"`
+	Policy string `yaml:"policy"`
+	// Functionaries is the directory functionary keys are loaded from and
+	// defaults to the directory of the policy.
+	Functionaries string `yaml:"functionaries,omitempty"`
+	Attestations  string `yaml:"attestations"`
+	// Params are the values of the policy parameters.
+	Params map[string]any `yaml:"params,omitempty"`
+	Expect Expectation    `yaml:"expect"`
+}
+
+type Expectation struct {
+	// Result is either "pass" or "fail".
+	Result string `yaml:"result"`
+	// Rule, PolicyType and Message narrow down an expected failure to an
+	// attestation rule, a policy of it, and a substring of the reason.
+	Rule       string `yaml:"rule,omitempty"`
+	PolicyType string `yaml:"policyType,omitempty"`
+	Message    string `yaml:"message,omitempty"`
+}
+
+const (
+	ResultPass = "pass"
+	ResultFail = "fail"
+)
+
+func LoadManifest(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{dir: filepath.Dir(path)}
+	if err := yaml.Unmarshal(raw, m); err != nil {
+		return nil, fmt.Errorf("failed to parse test manifest: %w", err)
+	}
+	if m.Name == "" {
+		m.Name = filepath.Base(path)
+	}
+	if len(m.Cases) == 0 {
+		return nil, errors.New("test manifest has no cases")
+	}
+	for _, c := range m.Cases {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid test case %q: %w", c.Name, err)
+		}
+	}
+	return m, nil
+}
+
+func (c *Case) validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("missing name")
+	case c.Policy == "":
+		return errors.New("missing policy")
+	case c.Attestations == "":
+		return errors.New("missing attestations")
+	case c.Expect.Result != ResultPass && c.Expect.Result != ResultFail:
+		return fmt.Errorf("expected result must be %s or %s", ResultPass, ResultFail)
+	case c.Expect.Result == ResultPass && (c.Expect.Rule != "" || c.Expect.PolicyType != "" || c.Expect.Message != ""):
+		return errors.New("a passing case cannot expect a failing rule, policy or message")
+	}
+	return nil
+}
+
+func (m *Manifest) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(m.dir, p)
+}
@@ -0,0 +1,128 @@
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+)
+
+type CaseResult struct {
+	Name     string
+	Passed   bool
+	Message  string
+	Duration time.Duration
+	// Verification is nil if the policy could not be verified at all.
+	Verification *policies.VerificationResult
+}
+
+// Run verifies every case of the manifest and checks its result against the
+// expectation.
+func Run(ctx context.Context, m *Manifest) []*CaseResult {
+	results := make([]*CaseResult, 0, len(m.Cases))
+	for _, c := range m.Cases {
+		start := time.Now()
+		r := m.runCase(ctx, c)
+		r.Duration = time.Since(start)
+		results = append(results, r)
+	}
+	return results
+}
+
+func (m *Manifest) runCase(ctx context.Context, c *Case) *CaseResult {
+	r := &CaseResult{Name: c.Name}
+
+	policyPath := m.path(c.Policy)
+	fdir := m.path(c.Functionaries)
+	if fdir == "" {
+		fdir = filepath.Dir(policyPath)
+	}
+
+	pd, err := policies.LoadPolicyDocument(policyPath)
+	if err != nil {
+		return r.check(c.Expect, err)
+	}
+	v, err := policies.NewVerifier(
+		policies.WithContext(ctx),
+		policies.WithKeySource(policies.NewDirectoryKeySource(fdir)),
+		policies.WithAttestationSource(policies.NewDirectoryAttestationSource(m.path(c.Attestations), nil)),
+		policies.WithParameters(c.Params),
+	)
+	if err != nil {
+		return r.check(c.Expect, err)
+	}
+	r.Verification, err = v.Verify(pd)
+	return r.check(c.Expect, err)
+}
+
+// check compares the outcome of a verification with the expectation. An
+// error verifying the policy counts as a failure outside of any rule.
+func (r *CaseResult) check(e Expectation, err error) *CaseResult {
+	switch {
+	case err != nil && e.Result == ResultPass:
+		r.Message = fmt.Sprintf("expected policy to pass, but it could not be verified: %v", err)
+	case err != nil && e.Rule != "":
+		r.Message = fmt.Sprintf("expected rule %s to fail, but the policy could not be verified: %v", e.Rule, err)
+	case err != nil && !strings.Contains(err.Error(), e.Message):
+		r.Message = fmt.Sprintf("expected failure containing %q, got: %v", e.Message, err)
+	case err != nil:
+		r.Passed = true
+	case e.Result == ResultPass && !r.Verification.Passed():
+		r.Message = "expected policy to pass, but it failed: " + describeFailures(r.Verification)
+	case e.Result == ResultPass:
+		r.Passed = true
+	case r.Verification.Passed():
+		r.Message = "expected policy to fail, but it passed"
+	default:
+		r.Message = matchFailure(r.Verification, e)
+		r.Passed = r.Message == ""
+	}
+	return r
+}
+
+func matchFailure(result *policies.VerificationResult, e Expectation) string {
+	for _, ar := range result.Failures() {
+		if e.Rule != "" && ar.Name != e.Rule {
+			continue
+		}
+		reasons := ar.Reasons
+		if e.PolicyType != "" {
+			reasons = nil
+			for _, p := range ar.Policies {
+				if p.Type == e.PolicyType && p.Status == policies.StatusFailed {
+					reasons = append(reasons, p.Reasons...)
+				}
+			}
+			if reasons == nil {
+				continue
+			}
+		}
+		if slices.ContainsFunc(reasons, func(reason string) bool { return strings.Contains(reason, e.Message) }) {
+			return ""
+		}
+	}
+
+	expected := "expected failure"
+	if e.Rule != "" {
+		expected += " of rule " + e.Rule
+	}
+	if e.PolicyType != "" {
+		expected += " in policy " + e.PolicyType
+	}
+	if e.Message != "" {
+		expected += fmt.Sprintf(" containing %q", e.Message)
+	}
+	return expected + ", got: " + describeFailures(result)
+}
+
+func describeFailures(result *policies.VerificationResult) string {
+	var failures []string
+	for _, ar := range result.Failures() {
+		failures = append(failures, fmt.Sprintf("%s (%s)", ar.Name, strings.Join(ar.Reasons, "; ")))
+	}
+	return strings.Join(failures, ", ")
+}
@@ -0,0 +1,28 @@
+package policytest
+
+import (
+	"context"
+	"testing"
+)
+
+// Check runs the test manifest at path as subtests of t, so that policy
+// regression tests can be part of go test:
+//
+//	func TestPolicies(t *testing.T) {
+//		policytest.Check(t, "testdata/policy-tests.yaml")
+//	}
+func Check(t *testing.T, path string) {
+	t.Helper()
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range m.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			r := m.runCase(context.Background(), c)
+			if !r.Passed {
+				t.Error(r.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package policies
+
+import (
+	"slices"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+type Status string
+
+const (
+	StatusPassed Status = "PASSED"
+	StatusFailed Status = "FAILED"
+	// StatusSkipped marks a rule whose match block found no attestation and
+	// allows that.
+	StatusSkipped Status = "SKIPPED"
+)
+
+type VerificationResult struct {
+	Status           Status                   `json:"status"`
+	AttestationRules []*AttestationRuleResult `json:"attestationRules"`
+	SubPolicies      []*SubPolicyResult       `json:"subPolicies,omitempty"`
+	// PolicyDigest is the digest of the policy document as it was loaded.
+	PolicyDigest map[string]string `json:"policyDigest,omitempty"`
+
+	// subjects are the subjects of the verified attestations no other rule
+	// depends on, i.e. the final products of the supply chain.
+	subjects []*ita.ResourceDescriptor
+	session  *verifiers.Session
+}
+
+type SubPolicyResult struct {
+	Name   string              `json:"name"`
+	Result *VerificationResult `json:"result"`
+}
+
+type AttestationRuleResult struct {
+	Name             string          `json:"name"`
+	Status           Status          `json:"status"`
+	AttestationFiles []string        `json:"attestationFiles,omitempty"`
+	KeyIDs           []string        `json:"keyIDs,omitempty"`
+	Functionaries    []string        `json:"functionaries,omitempty"`
+	Reasons          []string        `json:"reasons,omitempty"`
+	Policies         []*PolicyResult `json:"policies,omitempty"`
+	// Trace is only recorded when explaining a verification.
+	Trace []verifiers.ArtifactTrace `json:"trace,omitempty"`
+
+	statement    *ita.Statement
+	attestations []*Attestation
+}
+
+type PolicyResult struct {
+	Type    string   `json:"type"`
+	Status  Status   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+func (r *VerificationResult) Passed() bool {
+	return r.Status == StatusPassed
+}
+
+func (r *VerificationResult) Failures() []*AttestationRuleResult {
+	var failed []*AttestationRuleResult
+	for _, ar := range r.AttestationRules {
+		if ar.Status == StatusFailed {
+			failed = append(failed, ar)
+		}
+	}
+	for _, sp := range r.SubPolicies {
+		for _, ar := range sp.Result.Failures() {
+			namespaced := *ar
+			namespaced.Name = sp.Name + "." + ar.Name
+			failed = append(failed, &namespaced)
+		}
+	}
+	return failed
+}
+
+// ruleResults returns the results of the attestation rules of the policy
+// and of all of its sub-policies.
+func (r *VerificationResult) ruleResults() []*AttestationRuleResult {
+	results := slices.Clone(r.AttestationRules)
+	for _, sp := range r.SubPolicies {
+		results = append(results, sp.Result.ruleResults()...)
+	}
+	return results
+}
+
+// statements returns the verified statements of the policy and of all of
+// its sub-policies by their namespaced rule names.
+func (r *VerificationResult) statements() map[string]*ita.Statement {
+	statements := make(map[string]*ita.Statement)
+	for _, ar := range r.AttestationRules {
+		if ar.Status == StatusPassed && ar.statement != nil {
+			statements[ar.Name] = ar.statement
+		}
+	}
+	for _, sp := range r.SubPolicies {
+		for name, s := range sp.Result.statements() {
+			statements[sp.Name+"."+name] = s
+		}
+	}
+	return statements
+}
+
+func (ar *AttestationRuleResult) fail(err error) *AttestationRuleResult {
+	ar.Status = StatusFailed
+	ar.Reasons = append(ar.Reasons, err.Error())
+	return ar
+}
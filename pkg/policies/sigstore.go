@@ -0,0 +1,702 @@
+package policies
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const sigstoreBundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+const (
+	oidFulcioIssuer   = "1.3.6.1.4.1.57264.1.8"
+	oidFulcioIssuerV1 = "1.3.6.1.4.1.57264.1.1"
+	oidSCTList        = "1.3.6.1.4.1.11129.2.4.2"
+)
+
+// sigstoreFunctionary is a keyless functionary whose Sigstore bundles are
+// verified offline against a trusted root.
+//
+// Only DSSE bundles with a Fulcio certificate are accepted, which needs the
+// signed entry timestamp, inclusion proof, checkpoint and embedded SCT checks
+// below. sigstore-go implements them too, but requires a newer Go than this
+// module and brings in its TUF client and around ninety other modules. Each
+// check is covered by the fixture in sigstore_test.go, which breaks one part
+// of a bundle at a time.
+type sigstoreFunctionary struct {
+	identity      *models.SigstoreIdentity
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	// tlogs are the transparency logs by log ID.
+	tlogs map[string]*transparencyLog
+	// ctlogKeys are the certificate transparency log public keys by log ID.
+	ctlogKeys map[string]crypto.PublicKey
+}
+
+type transparencyLog struct {
+	key crypto.PublicKey
+	// host names the log in the origin and signatures of its checkpoints.
+	host string
+}
+
+type trustedRoot struct {
+	Tlogs []struct {
+		BaseURL   string `json:"baseUrl"`
+		PublicKey struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"publicKey"`
+	} `json:"tlogs"`
+	Ctlogs []struct {
+		PublicKey struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"publicKey"`
+	} `json:"ctlogs"`
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+	} `json:"certificateAuthorities"`
+}
+
+func newSigstoreFunctionary(id *models.SigstoreIdentity, dir string) (*sigstoreFunctionary, error) {
+	if id.Issuer == "" || id.Subject == "" {
+		return nil, errors.New("sigstore functionary requires an issuer and a subject")
+	}
+	if id.TrustedRootPath == "" {
+		return nil, errors.New("sigstore functionary requires a trusted root path")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id.TrustedRootPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trusted root: %w", err)
+	}
+	var tr trustedRoot
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted root: %w", err)
+	}
+
+	sf := &sigstoreFunctionary{
+		identity:      id,
+		roots:         x509.NewCertPool(),
+		intermediates: x509.NewCertPool(),
+		tlogs:         make(map[string]*transparencyLog),
+		ctlogKeys:     make(map[string]crypto.PublicKey),
+	}
+	for _, ca := range tr.CertificateAuthorities {
+		for _, c := range ca.CertChain.Certificates {
+			cert, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse trusted root certificate: %w", err)
+			}
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+				sf.roots.AddCert(cert)
+			} else {
+				sf.intermediates.AddCert(cert)
+			}
+		}
+	}
+
+	if id.RekorPublicKeyPath != "" {
+		if id.RekorURL == "" {
+			return nil, errors.New("sigstore functionary with a rekor public key requires a rekor URL")
+		}
+		data, err := os.ReadFile(filepath.Join(dir, id.RekorPublicKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rekor public key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("rekor public key is not PEM encoded")
+		}
+		if err := sf.addTlog(block.Bytes, id.RekorURL); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, tlog := range tr.Tlogs {
+			if err := sf.addTlog(tlog.PublicKey.RawBytes, tlog.BaseURL); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(sf.tlogs) == 0 {
+		return nil, errors.New("sigstore functionary has no transparency log keys")
+	}
+
+	for _, ctlog := range tr.Ctlogs {
+		logID, pub, err := parseLogKey(ctlog.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate transparency log key: %w", err)
+		}
+		sf.ctlogKeys[logID] = pub
+	}
+	if len(sf.ctlogKeys) == 0 {
+		return nil, errors.New("sigstore functionary has no certificate transparency log keys")
+	}
+	return sf, nil
+}
+
+func (sf *sigstoreFunctionary) addTlog(der []byte, baseURL string) error {
+	logID, pub, err := parseLogKey(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse transparency log key: %w", err)
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid transparency log URL: %q", baseURL)
+	}
+	sf.tlogs[logID] = &transparencyLog{key: pub, host: u.Host}
+	return nil
+}
+
+// parseLogKey parses the DER public key of a log, returning it along with
+// the log ID it is known by.
+func parseLogKey(der []byte) (string, crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", nil, err
+	}
+	logID := sha256.Sum256(der)
+	return hex.EncodeToString(logID[:]), pub, nil
+}
+
+// Bundles are protobuf JSON, which may encode 64-bit integers as strings.
+type jsonInt64 int64
+
+func (i *jsonInt64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = jsonInt64(n)
+	return nil
+}
+
+type sigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []*tlogEntry `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	DSSEEnvelope *dsse.Envelope `json:"dsseEnvelope"`
+}
+
+type tlogEntry struct {
+	LogIndex jsonInt64 `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   jsonInt64 `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   jsonInt64 `json:"logIndex"`
+		RootHash   []byte    `json:"rootHash"`
+		TreeSize   jsonInt64 `json:"treeSize"`
+		Hashes     [][]byte  `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+var errNotSigstoreBundle = errors.New("not a sigstore bundle")
+
+func parseSigstoreBundle(data []byte) (*sigstoreBundle, error) {
+	var b sigstoreBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(b.MediaType, sigstoreBundleMediaTypePrefix) {
+		return nil, fmt.Errorf("%w: %s", errNotSigstoreBundle, b.MediaType)
+	}
+	if b.DSSEEnvelope == nil {
+		return nil, errors.New("sigstore bundle does not hold a DSSE envelope")
+	}
+	return &b, nil
+}
+
+func (b *sigstoreBundle) leafCertificate() (*x509.Certificate, error) {
+	vm := b.VerificationMaterial
+	switch {
+	case vm.Certificate != nil:
+		return x509.ParseCertificate(vm.Certificate.RawBytes)
+	case vm.X509CertificateChain != nil && len(vm.X509CertificateChain.Certificates) > 0:
+		return x509.ParseCertificate(vm.X509CertificateChain.Certificates[0].RawBytes)
+	default:
+		return nil, errors.New("sigstore bundle does not hold a signing certificate")
+	}
+}
+
+func (sf *sigstoreFunctionary) Verifiers(a *Attestation, at time.Time) ([]dsse.Verifier, error) {
+	if a.SigstoreBundle == nil {
+		return nil, errors.New("attestation is not a sigstore bundle")
+	}
+	b, err := parseSigstoreBundle(a.SigstoreBundle)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := b.leafCertificate()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := b.DSSEEnvelope.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	var signed time.Time
+	var errs []error
+	for _, e := range b.VerificationMaterial.TlogEntries {
+		signed, err = sf.verifyTlogEntry(e, leaf, payload)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		break
+	}
+	if signed.IsZero() {
+		if len(errs) == 0 {
+			return nil, errors.New("sigstore bundle has no transparency log entries")
+		}
+		return nil, fmt.Errorf("no verifiable transparency log entry: %w", joinErrors(errs))
+	}
+
+	// Fulcio certificates are short lived, so they are checked at the time
+	// the transparency log signed for having recorded the signature rather
+	// than at the verification time.
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         sf.roots,
+		Intermediates: sf.intermediates,
+		CurrentTime:   signed,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("certificate does not chain to the fulcio root: %w", err)
+	}
+	// The SCT is signed over the key of the issuer, which a leaf that is
+	// itself in the trusted root does not have.
+	if len(chains[0]) < 2 {
+		return nil, errors.New("certificate is itself a fulcio root rather than issued by one")
+	}
+	if err := sf.verifyEmbeddedSCT(leaf, chains[0][1]); err != nil {
+		return nil, err
+	}
+	if err := sf.checkIdentity(leaf); err != nil {
+		return nil, err
+	}
+
+	vs := make([]dsse.Verifier, 0, len(b.DSSEEnvelope.Signatures))
+	for _, s := range b.DSSEEnvelope.Signatures {
+		v, err := newPublicKeyVerifier(leaf.PublicKey, s.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+func (sf *sigstoreFunctionary) checkIdentity(leaf *x509.Certificate) error {
+	if !hasExtension(leaf, oidFulcioIssuer, sf.identity.Issuer) && !hasExtension(leaf, oidFulcioIssuerV1, sf.identity.Issuer) {
+		return fmt.Errorf("certificate was not issued for OIDC issuer %s", sf.identity.Issuer)
+	}
+	subjects := slices.Clone(leaf.EmailAddresses)
+	for _, u := range leaf.URIs {
+		subjects = append(subjects, u.String())
+	}
+	if !slices.Contains(subjects, sf.identity.Subject) {
+		return fmt.Errorf("certificate was not issued to %s", sf.identity.Subject)
+	}
+	return nil
+}
+
+// verifyTlogEntry checks that a transparency log entry records the bundle's
+// signature and returns the time the log integrated it. An inclusion proof
+// does not cover that time, so the entry must also carry a signed entry
+// timestamp, whatever proof it has.
+func (sf *sigstoreFunctionary) verifyTlogEntry(e *tlogEntry, leaf *x509.Certificate, payload []byte) (time.Time, error) {
+	logID := hex.EncodeToString(e.LogID.KeyID)
+	tlog, ok := sf.tlogs[logID]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown transparency log: %s", logID)
+	}
+	if err := checkTlogBody(e.CanonicalizedBody, leaf, payload); err != nil {
+		return time.Time{}, err
+	}
+
+	if p := e.InclusionProof; p != nil {
+		leafHash := hashLeaf(e.CanonicalizedBody)
+		if err := verifyInclusion(uint64(p.LogIndex), uint64(p.TreeSize), leafHash, p.Hashes, p.RootHash); err != nil {
+			return time.Time{}, err
+		}
+		if err := verifyCheckpoint(p.Checkpoint.Envelope, uint64(p.TreeSize), p.RootHash, tlog, e.LogID.KeyID); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if e.InclusionPromise == nil {
+		return time.Time{}, errors.New("transparency log entry has no signed entry timestamp for its integrated time")
+	}
+	set, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{
+		Body:           base64.StdEncoding.EncodeToString(e.CanonicalizedBody),
+		IntegratedTime: int64(e.IntegratedTime),
+		LogID:          logID,
+		LogIndex:       int64(e.LogIndex),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySignature(tlog.key, set, e.InclusionPromise.SignedEntryTimestamp); err != nil {
+		return time.Time{}, fmt.Errorf("invalid signed entry timestamp: %w", err)
+	}
+	return time.Unix(int64(e.IntegratedTime), 0), nil
+}
+
+// checkTlogBody checks that a dsse or intoto Rekor entry records the
+// bundle's payload and signing certificate.
+func checkTlogBody(body []byte, leaf *x509.Certificate, payload []byte) error {
+	type hash struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"value"`
+	}
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			PayloadHash *hash `json:"payloadHash"`
+			Signatures  []struct {
+				Verifier []byte `json:"verifier"`
+			} `json:"signatures"`
+			Content struct {
+				PayloadHash *hash `json:"payloadHash"`
+				Envelope    struct {
+					Signatures []struct {
+						PublicKey []byte `json:"publicKey"`
+					} `json:"signatures"`
+				} `json:"envelope"`
+			} `json:"content"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	var ph *hash
+	var verifiers [][]byte
+	switch entry.Kind {
+	case "dsse":
+		ph = entry.Spec.PayloadHash
+		for _, s := range entry.Spec.Signatures {
+			verifiers = append(verifiers, s.Verifier)
+		}
+	case "intoto":
+		ph = entry.Spec.Content.PayloadHash
+		for _, s := range entry.Spec.Content.Envelope.Signatures {
+			verifiers = append(verifiers, s.PublicKey)
+		}
+	default:
+		return fmt.Errorf("unsupported transparency log entry kind: %s", entry.Kind)
+	}
+
+	digest := sha256.Sum256(payload)
+	if ph == nil || ph.Algorithm != "sha256" || ph.Value != hex.EncodeToString(digest[:]) {
+		return errors.New("transparency log entry does not match the bundle payload")
+	}
+	for _, v := range verifiers {
+		block, _ := pem.Decode(v)
+		if block != nil && bytes.Equal(block.Bytes, leaf.Raw) {
+			return nil
+		}
+	}
+	return errors.New("transparency log entry does not match the signing certificate")
+}
+
+// verifyEmbeddedSCT checks that the leaf certificate carries a signed
+// certificate timestamp from a trusted certificate transparency log, as
+// Fulcio embeds in the certificates it issues.
+func (sf *sigstoreFunctionary) verifyEmbeddedSCT(leaf, issuer *x509.Certificate) error {
+	var list []byte
+	for _, ext := range leaf.Extensions {
+		if ext.Id.String() != oidSCTList {
+			continue
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+			return fmt.Errorf("malformed signed certificate timestamps: %w", err)
+		}
+	}
+	if list == nil {
+		return errors.New("certificate carries no signed certificate timestamps")
+	}
+	scts, err := parseSCTList(list)
+	if err != nil {
+		return err
+	}
+	tbs, err := precertificateTBS(leaf)
+	if err != nil {
+		return err
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	var errs []error
+	for _, sct := range scts {
+		logID := hex.EncodeToString(sct.logID)
+		pub, ok := sf.ctlogKeys[logID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown certificate transparency log: %s", logID))
+			continue
+		}
+		if err := verifySignature(pub, sct.signedData(issuerKeyHash[:], tbs), sct.signature); err != nil {
+			errs = append(errs, fmt.Errorf("invalid signed certificate timestamp: %w", err))
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no valid signed certificate timestamp from a trusted log: %w", joinErrors(errs))
+}
+
+// signedCertificateTimestamp is an RFC 6962 SCT on a precertificate.
+type signedCertificateTimestamp struct {
+	logID      []byte
+	timestamp  uint64
+	extensions []byte
+	signature  []byte
+}
+
+func parseSCTList(data []byte) ([]*signedCertificateTimestamp, error) {
+	errMalformed := errors.New("malformed signed certificate timestamp list")
+	input := cryptobyte.String(data)
+	var list cryptobyte.String
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, errMalformed
+	}
+	var scts []*signedCertificateTimestamp
+	for !list.Empty() {
+		var raw, extensions, signature cryptobyte.String
+		var version, hashAlgorithm, signatureAlgorithm uint8
+		sct := &signedCertificateTimestamp{}
+		if !list.ReadUint16LengthPrefixed(&raw) ||
+			!raw.ReadUint8(&version) ||
+			!raw.ReadBytes(&sct.logID, 32) ||
+			!raw.ReadUint64(&sct.timestamp) ||
+			!raw.ReadUint16LengthPrefixed(&extensions) ||
+			!raw.ReadUint8(&hashAlgorithm) ||
+			!raw.ReadUint8(&signatureAlgorithm) ||
+			!raw.ReadUint16LengthPrefixed(&signature) ||
+			!raw.Empty() {
+			return nil, errMalformed
+		}
+		// Only v1 timestamps signed over SHA-256 are defined.
+		if version != 0 || hashAlgorithm != 4 {
+			continue
+		}
+		sct.extensions = extensions
+		sct.signature = signature
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// signedData returns the data the log signed for the SCT of a precertificate
+// entry.
+func (sct *signedCertificateTimestamp) signedData(issuerKeyHash, tbs []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(0) // v1
+	b.AddUint8(0) // certificate_timestamp
+	b.AddUint64(sct.timestamp)
+	b.AddUint16(1) // precert_entry
+	b.AddBytes(issuerKeyHash)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(tbs)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.extensions)
+	})
+	return b.BytesOrPanic()
+}
+
+// precertificateTBS returns the TBS certificate of leaf without its SCT list
+// extension, which is what the precertificate the log signed amounts to.
+func precertificateTBS(leaf *x509.Certificate) ([]byte, error) {
+	errMalformed := errors.New("malformed certificate")
+	extensionsTag := cbasn1.Tag(3).Constructed().ContextSpecific()
+
+	input := cryptobyte.String(leaf.RawTBSCertificate)
+	var tbs cryptobyte.String
+	if !input.ReadASN1(&tbs, cbasn1.SEQUENCE) {
+		return nil, errMalformed
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var field cryptobyte.String
+			var tag cbasn1.Tag
+			if !tbs.ReadAnyASN1Element(&field, &tag) {
+				b.SetError(errMalformed)
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(field)
+				continue
+			}
+			var extensions cryptobyte.String
+			if !field.ReadASN1(&field, extensionsTag) || !field.ReadASN1(&extensions, cbasn1.SEQUENCE) {
+				b.SetError(errMalformed)
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var ext, body cryptobyte.String
+						var oid asn1.ObjectIdentifier
+						if !extensions.ReadASN1Element(&ext, cbasn1.SEQUENCE) {
+							b.SetError(errMalformed)
+							return
+						}
+						body = ext
+						if !body.ReadASN1(&body, cbasn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&oid) {
+							b.SetError(errMalformed)
+							return
+						}
+						if oid.String() != oidSCTList {
+							b.AddBytes(ext)
+						}
+					}
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
+
+func hashLeaf(data []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, data...))
+	return h[:]
+}
+
+func hashChildren(l, r []byte) []byte {
+	h := sha256.Sum256(slices.Concat([]byte{1}, l, r))
+	return h[:]
+}
+
+// verifyInclusion checks an RFC 9162 Merkle inclusion proof.
+func verifyInclusion(index, size uint64, leafHash []byte, proof [][]byte, root []byte) error {
+	if index >= size {
+		return errors.New("inclusion proof index is outside the tree")
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return errors.New("inclusion proof does not match the root hash")
+	}
+	return nil
+}
+
+// verifyCheckpoint checks that a signed note of the transparency log commits
+// to the tree the inclusion proof was made against. Rekor names both the
+// checkpoint origin and its signature after the host of the log, and hints
+// at the signing key with the first four bytes of the log ID.
+func verifyCheckpoint(note string, size uint64, root []byte, tlog *transparencyLog, logID []byte) error {
+	text, sigs, ok := strings.Cut(note, "\n\n")
+	if !ok {
+		return errors.New("malformed checkpoint")
+	}
+	text += "\n"
+	lines := strings.Split(text, "\n")
+	if len(lines) < 3 {
+		return errors.New("malformed checkpoint")
+	}
+	if lines[0] != tlog.host && !strings.HasPrefix(lines[0], tlog.host+" - ") {
+		return fmt.Errorf("checkpoint origin %q is not the transparency log %s", lines[0], tlog.host)
+	}
+	if lines[1] != strconv.FormatUint(size, 10) || lines[2] != base64.StdEncoding.EncodeToString(root) {
+		return errors.New("checkpoint does not match the inclusion proof")
+	}
+
+	for _, line := range strings.Split(sigs, "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 || fields[0] != tlog.host {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(sig) < 5 || len(logID) < 4 || !bytes.Equal(sig[:4], logID[:4]) {
+			continue
+		}
+		if verifySignature(tlog.key, []byte(text), sig[4:]) == nil {
+			return nil
+		}
+	}
+	return errors.New("checkpoint is not signed by the transparency log")
+}
+
+func verifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+	default:
+		return fmt.Errorf("unsupported public key type: %T", pub)
+	}
+}
@@ -0,0 +1,478 @@
+package policies
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	testOIDCIssuer = "https://accounts.example.com"
+	testRekorURL   = "https://rekor.example.com"
+)
+
+// sigstoreFixture is a local Fulcio, Rekor and certificate transparency log
+// that issues Sigstore bundles. Tests adjust its fields to break one part of
+// the bundle at a time.
+type sigstoreFixture struct {
+	fulcio *testCertificate
+	rekor  *ecdsa.PrivateKey
+	ctlog  *ecdsa.PrivateKey
+
+	subject        string
+	integratedTime time.Time
+	certLifetime   time.Duration
+	// sctKey signs the embedded SCT, which is omitted when nil.
+	sctKey *ecdsa.PrivateKey
+	// setKey signs the signed entry timestamp, which is omitted when nil.
+	setKey *ecdsa.PrivateKey
+	// checkpointKey signs the checkpoint of the inclusion proof, which is
+	// omitted when nil.
+	checkpointKey    *ecdsa.PrivateKey
+	checkpointOrigin string
+	tamperProof      bool
+}
+
+func newSigstoreFixture(t *testing.T) *sigstoreFixture {
+	t.Helper()
+	now := time.Now()
+	f := &sigstoreFixture{
+		fulcio:           newTestCertificate(t, testCATemplate("fulcio", now.Add(-24*time.Hour), now.Add(24*time.Hour)), nil),
+		rekor:            newTestKey(t),
+		ctlog:            newTestKey(t),
+		subject:          "alice@example.com",
+		integratedTime:   now.Add(-time.Hour),
+		certLifetime:     10 * time.Minute,
+		checkpointOrigin: "rekor.example.com - 1193050959916656506",
+	}
+	f.sctKey = f.ctlog
+	f.setKey = f.rekor
+	f.checkpointKey = f.rekor
+	return f
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func publicKeyDER(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func testSign(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// functionary writes the trusted root of the fixture to a temporary
+// directory and returns a functionary for subject.
+func (f *sigstoreFixture) functionary(t *testing.T, subject string) *sigstoreFunctionary {
+	t.Helper()
+	rawBytes := func(der []byte) map[string]any {
+		return map[string]any{"rawBytes": der}
+	}
+	root := map[string]any{
+		"tlogs": []any{map[string]any{
+			"baseUrl":   testRekorURL,
+			"publicKey": rawBytes(publicKeyDER(t, f.rekor)),
+		}},
+		"ctlogs": []any{map[string]any{
+			"publicKey": rawBytes(publicKeyDER(t, f.ctlog)),
+		}},
+		"certificateAuthorities": []any{map[string]any{
+			"certChain": map[string]any{
+				"certificates": []any{rawBytes(f.fulcio.cert.Raw)},
+			},
+		}},
+	}
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "trusted_root.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := newSigstoreFunctionary(&models.SigstoreIdentity{
+		Issuer:          testOIDCIssuer,
+		Subject:         subject,
+		TrustedRootPath: "trusted_root.json",
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sf
+}
+
+// leaf issues a Fulcio certificate for the fixture's subject, embedding an
+// SCT signed over the precertificate unless sctKey is nil.
+func (f *sigstoreFixture) leaf(t *testing.T, key *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	issuer, err := asn1.Marshal(testOIDCIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := f.integratedTime.Add(-time.Minute)
+	template := func() *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:    big.NewInt(42),
+			Subject:         pkix.Name{},
+			EmailAddresses:  []string{f.subject},
+			NotBefore:       notBefore,
+			NotAfter:        notBefore.Add(f.certLifetime),
+			KeyUsage:        x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+			ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuer}},
+		}
+	}
+
+	precert := issueTestCertificate(t, template(), key, f.fulcio)
+	if f.sctKey == nil {
+		return precert.cert
+	}
+
+	sct := &signedCertificateTimestamp{timestamp: uint64(notBefore.UnixMilli())}
+	logID := sha256.Sum256(publicKeyDER(t, f.sctKey))
+	issuerKeyHash := sha256.Sum256(f.fulcio.cert.RawSubjectPublicKeyInfo)
+	sig := testSign(t, f.sctKey, sct.signedData(issuerKeyHash[:], precert.cert.RawTBSCertificate))
+
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+			b.AddBytes(logID[:])
+			b.AddUint64(sct.timestamp)
+			b.AddUint16(0)
+			b.AddUint8(4) // sha256
+			b.AddUint8(3) // ecdsa
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sig)
+			})
+		})
+	})
+	list, err := asn1.Marshal(b.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	final := template()
+	final.ExtraExtensions = append(final.ExtraExtensions, pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, Value: list})
+	return issueTestCertificate(t, final, key, f.fulcio).cert
+}
+
+// bundle returns an attestation holding a Sigstore bundle of a DSSE envelope
+// signed by a fresh Fulcio certificate and recorded in the fixture's log.
+func (f *sigstoreFixture) bundle(t *testing.T) *Attestation {
+	t.Helper()
+	key := newTestKey(t)
+	leaf := f.leaf(t, key)
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"foo","digest":{"sha256":"` + strings.Repeat("0", 64) + `"}}],"predicateType":"https://example.com/predicate","predicate":{}}`)
+	signature := testSign(t, key, dsse.PAE(inTotoPayloadType, payload))
+	envelope := &dsse.Envelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsse.Signature{{Sig: base64.StdEncoding.EncodeToString(signature)}},
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]any{
+			"payloadHash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			"signatures": []any{map[string]any{
+				"signature": envelope.Signatures[0].Sig,
+				"verifier":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logID := sha256.Sum256(publicKeyDER(t, f.rekor))
+	const logIndex = 2
+	entry := map[string]any{
+		"logIndex":          strconv.Itoa(logIndex),
+		"logId":             map[string]any{"keyId": logID[:]},
+		"integratedTime":    strconv.FormatInt(f.integratedTime.Unix(), 10),
+		"canonicalizedBody": body,
+	}
+
+	if f.setKey != nil {
+		set, err := json.Marshal(map[string]any{
+			"body":           base64.StdEncoding.EncodeToString(body),
+			"integratedTime": f.integratedTime.Unix(),
+			"logID":          hex.EncodeToString(logID[:]),
+			"logIndex":       logIndex,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry["inclusionPromise"] = map[string]any{"signedEntryTimestamp": testSign(t, f.setKey, set)}
+	}
+
+	if f.checkpointKey != nil {
+		// A tree of three leaves, with the entry as the last one.
+		h0, h1, h2 := hashLeaf([]byte("first")), hashLeaf([]byte("second")), hashLeaf(body)
+		sibling := hashChildren(h0, h1)
+		root := hashChildren(sibling, h2)
+		if f.tamperProof {
+			sibling = hashChildren(h1, h0)
+		}
+		text := fmt.Sprintf("%s\n3\n%s\n", f.checkpointOrigin, base64.StdEncoding.EncodeToString(root))
+		sig := append(logID[:4:4], testSign(t, f.checkpointKey, []byte(text))...)
+		host, _, _ := strings.Cut(f.checkpointOrigin, " ")
+		entry["inclusionProof"] = map[string]any{
+			"logIndex": strconv.Itoa(logIndex),
+			"rootHash": root,
+			"treeSize": "3",
+			"hashes":   [][]byte{sibling},
+			"checkpoint": map[string]any{
+				"envelope": text + "\n— " + host + " " + base64.StdEncoding.EncodeToString(sig) + "\n",
+			},
+		}
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": leaf.Raw},
+			"tlogEntries": []any{entry},
+		},
+		"dsseEnvelope": envelope,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Attestation{Name: "bundle.sigstore.json", Envelope: envelope, SigstoreBundle: data}
+}
+
+func TestSigstoreFunctionary(t *testing.T) {
+	tests := []struct {
+		name string
+		// change breaks the fixture before the bundle is issued.
+		change  func(t *testing.T, f *sigstoreFixture)
+		subject string
+		wantErr string
+	}{
+		{
+			name:    "good bundle",
+			subject: "alice@example.com",
+		},
+		{
+			name:    "good bundle without inclusion proof",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.checkpointKey = nil },
+			subject: "alice@example.com",
+		},
+		{
+			name:    "tampered inclusion proof",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.tamperProof = true },
+			subject: "alice@example.com",
+			wantErr: "inclusion proof does not match the root hash",
+		},
+		{
+			name:    "inclusion proof without signed entry timestamp",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.setKey = nil },
+			subject: "alice@example.com",
+			wantErr: "no signed entry timestamp",
+		},
+		{
+			name:    "wrong log key",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.setKey = newTestKey(t) },
+			subject: "alice@example.com",
+			wantErr: "invalid signed entry timestamp",
+		},
+		{
+			name:    "checkpoint signed by wrong log key",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.checkpointKey = newTestKey(t) },
+			subject: "alice@example.com",
+			wantErr: "checkpoint is not signed by the transparency log",
+		},
+		{
+			name: "checkpoint of another log",
+			change: func(t *testing.T, f *sigstoreFixture) {
+				f.checkpointOrigin = "rekor.example.org - 1193050959916656506"
+			},
+			subject: "alice@example.com",
+			wantErr: "is not the transparency log rekor.example.com",
+		},
+		{
+			name:    "wrong identity",
+			subject: "bob@example.com",
+			wantErr: "certificate was not issued to bob@example.com",
+		},
+		{
+			name:    "certificate expired when the log integrated the signature",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.certLifetime = 30 * time.Second },
+			subject: "alice@example.com",
+			wantErr: "certificate has expired or is not yet valid",
+		},
+		{
+			name:    "missing signed certificate timestamp",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.sctKey = nil },
+			subject: "alice@example.com",
+			wantErr: "certificate carries no signed certificate timestamps",
+		},
+		{
+			name:    "signed certificate timestamp from an unknown log",
+			change:  func(t *testing.T, f *sigstoreFixture) { f.sctKey = newTestKey(t) },
+			subject: "alice@example.com",
+			wantErr: "unknown certificate transparency log",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSigstoreFixture(t)
+			if tt.change != nil {
+				tt.change(t, f)
+			}
+			a := f.bundle(t)
+			sf := f.functionary(t, tt.subject)
+
+			vs, err := sf.Verifiers(a, time.Now())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ev, err := dsse.NewEnvelopeVerifier(vs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ev.Verify(context.Background(), a.Envelope); err != nil {
+				t.Fatalf("envelope does not verify with the certificate key: %v", err)
+			}
+		})
+	}
+}
+
+func TestSigstoreFunctionaryUnknownLog(t *testing.T) {
+	f := newSigstoreFixture(t)
+	a := f.bundle(t)
+	f.rekor = newTestKey(t)
+	sf := f.functionary(t, "alice@example.com")
+
+	_, err := sf.Verifiers(a, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "unknown transparency log") {
+		t.Fatalf("expected unknown transparency log error, got: %v", err)
+	}
+}
+
+func TestSigstoreFunctionaryLeafInTrustedRoot(t *testing.T) {
+	f := newSigstoreFixture(t)
+	a := f.bundle(t)
+	var b struct {
+		VerificationMaterial struct {
+			Certificate struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificate"`
+		} `json:"verificationMaterial"`
+	}
+	if err := json.Unmarshal(a.SigstoreBundle, &b); err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(b.VerificationMaterial.Certificate.RawBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := f.functionary(t, "alice@example.com")
+	sf.roots.AddCert(leaf)
+
+	_, err = sf.Verifiers(a, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "certificate is itself a fulcio root") {
+		t.Fatalf("expected the leaf in the trusted root to be rejected, got: %v", err)
+	}
+}
+
+// merkleTree returns the RFC 9162 root hash of the leaves and the inclusion
+// proof of the leaf at index.
+func merkleTree(leaves [][]byte, index int) (root []byte, proof [][]byte) {
+	if len(leaves) == 1 {
+		return hashLeaf(leaves[0]), nil
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	left, leftProof := merkleTree(leaves[:k], index)
+	right, rightProof := merkleTree(leaves[k:], index-k)
+	if index < k {
+		return hashChildren(left, right), append(leftProof, right)
+	}
+	return hashChildren(left, right), append(rightProof, left)
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := make([][]byte, size)
+		for i := range leaves {
+			leaves[i] = []byte(strconv.Itoa(i))
+		}
+		for index := 0; index < size; index++ {
+			root, proof := merkleTree(leaves, index)
+			leafHash := hashLeaf(leaves[index])
+			if err := verifyInclusion(uint64(index), uint64(size), leafHash, proof, root); err != nil {
+				t.Errorf("leaf %d of %d: %v", index, size, err)
+			}
+			if size == 1 {
+				continue
+			}
+			if err := verifyInclusion(uint64(index), uint64(size), hashLeaf([]byte("other")), proof, root); err == nil {
+				t.Errorf("leaf %d of %d: accepted the proof for another leaf", index, size)
+			}
+			if err := verifyInclusion(uint64((index+1)%size), uint64(size), leafHash, proof, root); err == nil {
+				t.Errorf("leaf %d of %d: accepted the proof at another index", index, size)
+			}
+			if err := verifyInclusion(uint64(index), uint64(size), leafHash, proof[:len(proof)-1], root); err == nil {
+				t.Errorf("leaf %d of %d: accepted a truncated proof", index, size)
+			}
+			if err := verifyInclusion(uint64(index), uint64(size), leafHash, append(proof, root), root); err == nil {
+				t.Errorf("leaf %d of %d: accepted an extended proof", index, size)
+			}
+		}
+	}
+	if err := verifyInclusion(3, 3, hashLeaf(nil), nil, hashLeaf(nil)); err == nil {
+		t.Error("accepted an index outside the tree")
+	}
+}
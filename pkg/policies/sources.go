@@ -0,0 +1,197 @@
+package policies
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"go.uber.org/zap"
+)
+
+// KeySource resolves a functionary defined in a policy document to the
+// Functionary used to check its signatures.
+type KeySource interface {
+	Functionary(f *models.Functionary) (Functionary, error)
+}
+
+// AttestationSource provides the attestations a policy document is verified
+// against.
+type AttestationSource interface {
+	Attestations(ctx context.Context) ([]*Attestation, error)
+}
+
+type Attestation struct {
+	// Name identifies where the attestation came from, e.g. its file path.
+	Name     string
+	Envelope *dsse.Envelope
+	// Digest of the attestation as it was read, keyed by algorithm. It is
+	// computed from the envelope when not set.
+	Digest map[string]string
+	// Certificates holds the PEM certificate chain carried alongside each
+	// signature in the envelope, if any, indexed like Envelope.Signatures.
+	Certificates []string
+	// SigstoreBundle holds the raw bundle the envelope was taken from, if
+	// the attestation is a Sigstore bundle.
+	SigstoreBundle []byte
+}
+
+type directoryKeySource struct {
+	dir string
+}
+
+// NewDirectoryKeySource returns a KeySource that loads functionary public
+// keys relative to dir. An empty dir is the current working directory.
+func NewDirectoryKeySource(dir string) KeySource {
+	return &directoryKeySource{dir: dir}
+}
+
+func (ks *directoryKeySource) Functionary(f *models.Functionary) (Functionary, error) {
+	switch {
+	case f.Certificate != nil && f.Sigstore != nil:
+		return nil, fmt.Errorf("functionary %s must not be both a certificate and a sigstore functionary", f.Name)
+	case f.Certificate != nil:
+		return newCertificateFunctionary(f.Certificate, ks.dir)
+	case f.Sigstore != nil:
+		return newSigstoreFunctionary(f.Sigstore, ks.dir)
+	}
+
+	var data []byte
+	switch {
+	case f.PublicKey != "" && f.PublicKeyPath != "":
+		return nil, fmt.Errorf("functionary %s must not set both publicKey and publicKeyPath", f.Name)
+	case f.PublicKey != "":
+		data = []byte(f.PublicKey)
+	default:
+		var err error
+		data, err = os.ReadFile(filepath.Join(ks.dir, f.PublicKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load public key of functionary %s: %w", f.Name, err)
+		}
+	}
+	v, err := loadPublicKeyVerifier(data, f.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load public key of functionary %s: %w", f.Name, err)
+	}
+	return &keyFunctionary{v}, nil
+}
+
+type directoryAttestationSource struct {
+	dir    string
+	logger *zap.Logger
+}
+
+// NewDirectoryAttestationSource returns an AttestationSource that reads every
+// .json, .link and .sigstore file in dir that holds a DSSE envelope or a
+// Sigstore bundle. An empty dir is the current working directory. Files that
+// cannot be read or parsed are skipped with a warning on logger, which may be
+// nil.
+func NewDirectoryAttestationSource(dir string, logger *zap.Logger) AttestationSource {
+	if dir == "" {
+		dir = "."
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &directoryAttestationSource{dir: dir, logger: logger}
+}
+
+func (as *directoryAttestationSource) Attestations(ctx context.Context) ([]*Attestation, error) {
+	dir_entries, err := os.ReadDir(as.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations []*Attestation
+	for _, de := range dir_entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := de.Name()
+		if ext := filepath.Ext(name); de.IsDir() || (ext != ".json" && ext != ".link" && ext != ".sigstore") {
+			continue
+		}
+		file := filepath.Join(as.dir, name)
+		a, err := readAttestation(file)
+		if err != nil {
+			as.logger.Sugar().Warnw("skipping unreadable attestation",
+				"file", file,
+				"error", err,
+			)
+			continue
+		}
+		if a.Envelope.PayloadType == "" {
+			// Not every JSON file next to the attestations is an envelope.
+			continue
+		}
+		attestations = append(attestations, a)
+	}
+	return attestations, nil
+}
+
+// envelopeCertificates picks up the certificate an envelope signature may
+// carry next to its key ID, which dsse.Signature does not model.
+type envelopeCertificates struct {
+	Signatures []struct {
+		Cert string `json:"cert"`
+	} `json:"signatures"`
+}
+
+func readAttestation(f string) (*Attestation, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := parseSigstoreBundle(data)
+	switch {
+	case err == nil:
+		return &Attestation{
+			Name:           f,
+			Envelope:       b.DSSEEnvelope,
+			Digest:         sha256Digest(data),
+			SigstoreBundle: data,
+		}, nil
+	case !errors.Is(err, errNotSigstoreBundle):
+		return nil, err
+	}
+
+	var envelope dsse.Envelope
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Attestation{
+		Name:     f,
+		Envelope: &envelope,
+		Digest:   sha256Digest(data),
+	}
+
+	var certs envelopeCertificates
+	err = json.Unmarshal(data, &certs)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range certs.Signatures {
+		if s.Cert != "" {
+			if a.Certificates == nil {
+				a.Certificates = make([]string, len(envelope.Signatures))
+			}
+			a.Certificates[i] = s.Cert
+		}
+	}
+
+	return a, nil
+}
+
+func sha256Digest(data []byte) map[string]string {
+	digest := sha256.Sum256(data)
+	return map[string]string{"sha256": hex.EncodeToString(digest[:])}
+}
@@ -0,0 +1,173 @@
+package policies
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"go.uber.org/zap"
+)
+
+func TestVerifyThreshold(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	bob := newTestSigner(t, "bob")
+	products := testArtifacts{"app": strings.Repeat("a", 64)}
+	otherProducts := testArtifacts{"app": strings.Repeat("b", 64)}
+
+	named := func(name string, a *Attestation) *Attestation {
+		a.Name = name
+		return a
+	}
+	tests := []struct {
+		name              string
+		threshold         int
+		attestations      []*Attestation
+		wantFunctionaries []string
+		wantReason        string
+	}{
+		{
+			name:              "one envelope signed by both",
+			threshold:         2,
+			attestations:      []*Attestation{newTestLink(t, "build", nil, products, alice, bob)},
+			wantFunctionaries: []string{"alice", "bob"},
+		},
+		{
+			name:      "envelopes of the same statement signed by each",
+			threshold: 2,
+			attestations: []*Attestation{
+				named("build.alice.link", newTestLink(t, "build", nil, products, alice)),
+				named("build.bob.link", newTestLink(t, "build", nil, products, bob)),
+			},
+			wantFunctionaries: []string{"alice", "bob"},
+		},
+		{
+			name:         "one functionary signing twice in one envelope",
+			threshold:    2,
+			attestations: []*Attestation{newTestLink(t, "build", nil, products, alice, alice)},
+			wantReason:   "signed by 1 distinct functionaries, threshold is 2",
+		},
+		{
+			name:      "one functionary signing two envelopes",
+			threshold: 2,
+			attestations: []*Attestation{
+				named("build.1.link", newTestLink(t, "build", nil, products, alice)),
+				named("build.2.link", newTestLink(t, "build", nil, products, alice)),
+			},
+			wantReason: "signed by 1 distinct functionaries, threshold is 2",
+		},
+		{
+			name:      "envelopes of different statements",
+			threshold: 2,
+			attestations: []*Attestation{
+				named("build.alice.link", newTestLink(t, "build", nil, products, alice)),
+				named("build.bob.link", newTestLink(t, "build", nil, otherProducts, bob)),
+			},
+			wantReason: "signed by 1 distinct functionaries, threshold is 2",
+		},
+		{
+			name:              "threshold of one",
+			threshold:         1,
+			attestations:      []*Attestation{newTestLink(t, "build", nil, products, bob)},
+			wantFunctionaries: []string{"bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := `
+attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice, bob]
+    threshold: ` + strconv.Itoa(tt.threshold) + `
+`
+			ar := testRuleResult(verifyTestPolicy(t, policy, tt.attestations, alice, bob), "build")
+			if tt.wantReason != "" {
+				if ar.Status != StatusFailed || !strings.Contains(strings.Join(ar.Reasons, "\n"), tt.wantReason) {
+					t.Fatalf("expected failure with %q, got %s: %v", tt.wantReason, ar.Status, ar.Reasons)
+				}
+				return
+			}
+			if ar.Status != StatusPassed {
+				t.Fatalf("status is %s: %v", ar.Status, ar.Reasons)
+			}
+			functionaries := slices.Clone(ar.Functionaries)
+			slices.Sort(functionaries)
+			if !slices.Equal(functionaries, tt.wantFunctionaries) {
+				t.Errorf("functionaries are %v, want %v", functionaries, tt.wantFunctionaries)
+			}
+		})
+	}
+}
+
+// TestVerifyCreditsSigningFunctionary checks that signatures are credited to
+// the functionary whose certificate verified them, even when the envelope
+// gives every signature the same key ID.
+func TestVerifyCreditsSigningFunctionary(t *testing.T) {
+	now := time.Now()
+	root := newTestCertificate(t, testCATemplate("root", now.Add(-24*time.Hour), now.Add(24*time.Hour)), nil)
+	leaf := func(email string) *testCertificate {
+		template := testLeafTemplate(now.Add(-time.Hour), now.Add(time.Hour))
+		template.EmailAddresses = []string{email}
+		return newTestCertificate(t, template, root)
+	}
+	alice, bob := leaf("alice@example.com"), leaf("bob@example.com")
+	functionary := func(email string) *certificateFunctionary {
+		cf := &certificateFunctionary{
+			constraints: &models.CertificateConstraints{Emails: []string{email}},
+			roots:       x509.NewCertPool(),
+		}
+		cf.roots.AddCert(root.cert)
+		return cf
+	}
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1",` +
+		`"subject":[{"name":"app","digest":{"sha256":"` + strings.Repeat("a", 64) + `"}}],` +
+		`"predicateType":"https://in-toto.io/attestation/link/v0.3","predicate":{"name":"build"}}`)
+	pae := dsse.PAE(inTotoPayloadType, payload)
+	a := &Attestation{
+		Name: "build.link",
+		Envelope: &dsse.Envelope{
+			PayloadType: inTotoPayloadType,
+			Payload:     base64.StdEncoding.EncodeToString(payload),
+			Signatures: []dsse.Signature{
+				{KeyID: "shared", Sig: base64.StdEncoding.EncodeToString(testSign(t, alice.key, pae))},
+			},
+		},
+		Certificates: []string{
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: alice.cert.Raw})),
+		},
+	}
+	// bob's certificate comes with a signature that does not verify, so both
+	// functionaries have a verifier reporting the key ID "shared".
+	a.Envelope.Signatures = append(a.Envelope.Signatures, dsse.Signature{
+		KeyID: "shared",
+		Sig:   base64.StdEncoding.EncodeToString(testSign(t, bob.key, []byte("something else"))),
+	})
+	a.Certificates = append(a.Certificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bob.cert.Raw})))
+
+	vn := &verification{
+		ctx:   context.Background(),
+		at:    now,
+		sugar: zap.NewNop().Sugar(),
+		functionaries: map[string]Functionary{
+			"alice": functionary("alice@example.com"),
+			"bob":   functionary("bob@example.com"),
+		},
+	}
+	ar := &models.AttestationRule{Name: "build", AllowedFunctionaries: []string{"alice", "bob"}}
+	result := &AttestationRuleResult{Name: "build"}
+	if _, _, err := vn.verifySignatures(ar, []*Attestation{a}, result); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Functionaries, []string{"alice"}) {
+		t.Errorf("signature credited to %v, want [alice]", result.Functionaries)
+	}
+}
@@ -0,0 +1,28 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+)
+
+var (
+	ErrPolicyExpired     = errors.New("policy has expired")
+	ErrPolicyNotYetValid = errors.New("policy is not yet valid")
+)
+
+// checkValidity returns ErrPolicyExpired or ErrPolicyNotYetValid if at is
+// outside the validity window of the policy document.
+func checkValidity(pd models.PolicyDocument, at time.Time) error {
+	if pd.Expires != nil && !at.Before(*pd.Expires) {
+		return fmt.Errorf("%w: expired at %s, verification time is %s",
+			ErrPolicyExpired, pd.Expires.Format(time.RFC3339), at.Format(time.RFC3339))
+	}
+	if pd.NotBefore != nil && at.Before(*pd.NotBefore) {
+		return fmt.Errorf("%w: valid from %s, verification time is %s",
+			ErrPolicyNotYetValid, pd.NotBefore.Format(time.RFC3339), at.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package policies
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+)
+
+func TestCheckValidity(t *testing.T) {
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pd := models.PolicyDocument{NotBefore: &notBefore, Expires: &expires}
+
+	tests := []struct {
+		name    string
+		pd      models.PolicyDocument
+		at      time.Time
+		wantErr error
+	}{
+		{"unbounded", models.PolicyDocument{}, notBefore, nil},
+		{"within", pd, notBefore.Add(time.Hour), nil},
+		{"at notBefore", pd, notBefore, nil},
+		{"before notBefore", pd, notBefore.Add(-time.Second), ErrPolicyNotYetValid},
+		{"at expires", pd, expires, ErrPolicyExpired},
+		{"after expires", pd, expires.Add(time.Hour), ErrPolicyExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkValidity(tt.pd, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package policies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
+	"go.uber.org/zap"
+)
+
+// Verifier verifies policy documents against the functionaries and
+// attestations provided by its sources. It holds no per-verification state,
+// so Verify may be called repeatedly and from multiple goroutines.
+type Verifier struct {
+	logger       *zap.Logger
+	keys         KeySource
+	attestations AttestationSource
+	ctx          context.Context
+	workers      int
+	explain      bool
+	at           time.Time
+	parameters   map[string]any
+}
+
+type Option func(*Verifier) error
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(v *Verifier) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		v.logger = logger
+		return nil
+	}
+}
+
+func WithKeySource(ks KeySource) Option {
+	return func(v *Verifier) error {
+		if ks == nil {
+			return errors.New("key source must not be nil")
+		}
+		v.keys = ks
+		return nil
+	}
+}
+
+func WithAttestationSource(as AttestationSource) Option {
+	return func(v *Verifier) error {
+		if as == nil {
+			return errors.New("attestation source must not be nil")
+		}
+		v.attestations = as
+		return nil
+	}
+}
+
+func WithContext(ctx context.Context) Option {
+	return func(v *Verifier) error {
+		if ctx == nil {
+			return errors.New("context must not be nil")
+		}
+		v.ctx = ctx
+		return nil
+	}
+}
+
+// WithMaxWorkers limits how many independent attestation rules are verified
+// concurrently. It defaults to GOMAXPROCS.
+func WithMaxWorkers(n int) Option {
+	return func(v *Verifier) error {
+		if n < 1 {
+			return errors.New("max workers must be at least 1")
+		}
+		v.workers = n
+		return nil
+	}
+}
+
+// WithExplain records how artifact rules treat each artifact in the
+// Trace of the attestation rule results.
+func WithExplain(explain bool) Option {
+	return func(v *Verifier) error {
+		v.explain = explain
+		return nil
+	}
+}
+
+// WithVerificationTime checks the validity window of policies and of
+// functionary certificates at t instead of the current time, e.g. to
+// reproduce a past verification.
+func WithVerificationTime(t time.Time) Option {
+	return func(v *Verifier) error {
+		if t.IsZero() {
+			return errors.New("verification time must not be zero")
+		}
+		v.at = t
+		return nil
+	}
+}
+
+// WithParameters supplies values for the parameters declared by policies,
+// including those of sub-policies. Values may be given as strings, as on the
+// command line, or typed as decoded from YAML.
+func WithParameters(values map[string]any) Option {
+	return func(v *Verifier) error {
+		v.parameters = values
+		return nil
+	}
+}
+
+func NewVerifier(opts ...Option) (*Verifier, error) {
+	v := &Verifier{
+		logger:  zap.NewNop(),
+		ctx:     context.Background(),
+		workers: runtime.GOMAXPROCS(0),
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	if v.keys == nil {
+		return nil, errors.New("no key source configured")
+	}
+	if v.attestations == nil {
+		return nil, errors.New("no attestation source configured")
+	}
+	return v, nil
+}
+
+// verification holds the state of a single call to Verifier.Verify.
+type verification struct {
+	mu            sync.Mutex
+	ctx           context.Context
+	workers       int
+	at            time.Time
+	sugar         *zap.SugaredLogger
+	functionaries map[string]Functionary
+	session       *verifiers.Session
+
+	attestationList    []*Attestation
+	attestationsByName map[string][]*Attestation
+}
+
+func (v *Verifier) Verify(pd models.PolicyDocument) (*VerificationResult, error) {
+	if err := checkParameters(pd, v.parameters); err != nil {
+		v.logger.Sugar().Errorw("invalid policy parameters",
+			"error", err,
+		)
+		return nil, err
+	}
+	return v.verify(pd)
+}
+
+func (v *Verifier) verify(pd models.PolicyDocument) (*VerificationResult, error) {
+	vn := &verification{
+		ctx:     v.ctx,
+		workers: v.workers,
+		sugar:   v.logger.Sugar(),
+	}
+	vn.sugar.Infof("start policy verification")
+
+	at := v.at
+	if at.IsZero() {
+		at = time.Now()
+	}
+	vn.at = at
+	if err := checkValidity(pd, at); err != nil {
+		vn.sugar.Errorw("policy is not valid",
+			"error", err,
+		)
+		return nil, err
+	}
+
+	params, err := resolveParameters(pd.Parameters, v.parameters)
+	if err == nil {
+		pd, err = applyParameters(pd, params)
+	}
+	if err != nil {
+		vn.sugar.Errorw("failed to apply policy parameters",
+			"error", err,
+		)
+		return nil, err
+	}
+
+	g, err := buildRuleGraph(pd.AttestationRules, pd.SubPolicies)
+	if err != nil {
+		vn.sugar.Errorw("failed to build attestation rule graph",
+			"error", err,
+		)
+		return nil, err
+	}
+
+	vm, err := vn.parseFunctionaries(pd.Functionaries, v.keys)
+	if err != nil {
+		vn.sugar.Errorw("failed to parse functionaries",
+			"error", err,
+		)
+		return nil, err
+	}
+	vn.functionaries = vm
+
+	as, err := v.attestations.Attestations(vn.ctx)
+	if err != nil {
+		vn.sugar.Errorw("failed to load attestations",
+			"error", err,
+		)
+		return nil, err
+	}
+	slices.SortFunc(as, func(a, b *Attestation) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	vn.attestationList = as
+	vn.attestationsByName = mapAttestations(as)
+
+	vn.session, err = verifiers.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	if v.explain {
+		vn.session.EnableTrace()
+	}
+	if err := vn.session.SetParameters(params); err != nil {
+		return nil, err
+	}
+
+	subPolicies, err := v.verifySubPolicies(vn, pd.SubPolicies)
+	if err != nil {
+		vn.sugar.Errorw("failed to verify sub-policies",
+			"error", err,
+		)
+		return nil, err
+	}
+
+	result := vn.verifyAttestationRules(g, subPolicies)
+	result.PolicyDigest = pd.Digest
+	if !result.Passed() {
+		vn.sugar.Errorw("policy verification failed",
+			"failedAttestationRules", len(result.Failures()),
+		)
+	}
+	return result, nil
+}
+
+// verifySubPolicies verifies every sub-policy with the sources of the
+// verifier and imports what it recorded into the session under its name.
+// A failed sub-policy is only recorded in its result.
+func (v *Verifier) verifySubPolicies(vn *verification, sps []*models.SubPolicy) ([]*SubPolicyResult, error) {
+	results := make([]*SubPolicyResult, 0, len(sps))
+	for _, sp := range sps {
+		if sp.Policy == nil {
+			return nil, fmt.Errorf("sub-policy %s is not loaded", sp.Name)
+		}
+		vn.sugar.Infow("start verifying sub-policy",
+			"name", sp.Name,
+		)
+		result, err := v.verify(*sp.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify sub-policy %s: %w", sp.Name, err)
+		}
+		results = append(results, &SubPolicyResult{Name: sp.Name, Result: result})
+		if !result.Passed() {
+			vn.sugar.Errorw("sub-policy verification failed",
+				"name", sp.Name,
+			)
+			continue
+		}
+		if err := vn.session.Import(sp.Name, result.session, result.statements(), result.subjects); err != nil {
+			return nil, fmt.Errorf("failed to import sub-policy %s: %w", sp.Name, err)
+		}
+	}
+	return results, nil
+}
+
+func mapAttestations(as []*Attestation) map[string][]*Attestation {
+	ma := make(map[string][]*Attestation)
+
+	for _, a := range as {
+		name := filepath.Base(a.Name)
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		ma[name] = append(ma[name], a)
+	}
+
+	return ma
+}
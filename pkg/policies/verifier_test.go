@@ -0,0 +1,108 @@
+package policies_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+)
+
+func newTestVerifier(t *testing.T) *policies.Verifier {
+	t.Helper()
+	v, err := policies.NewVerifier(
+		policies.WithKeySource(policies.NewDirectoryKeySource("../../test/data")),
+		policies.WithAttestationSource(policies.NewDirectoryAttestationSource("../../test/data", nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func loadTestPolicy(t *testing.T, name string) models.PolicyDocument {
+	t.Helper()
+	pd, err := policies.LoadPolicyDocument("../../test/data/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pd
+}
+
+func ruleNames(result *policies.VerificationResult) []string {
+	var names []string
+	for _, ar := range result.AttestationRules {
+		names = append(names, ar.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestVerifyPoliciesBackToBack(t *testing.T) {
+	v := newTestVerifier(t)
+	for _, tt := range []struct {
+		policy string
+		rules  []string
+	}{
+		{"policy.yaml", []string{"build_external", "build_main", "build_testy", "untar"}},
+		{"rule-references.yaml", []string{"build_main", "untar"}},
+		{"policy.yaml", []string{"build_external", "build_main", "build_testy", "untar"}},
+	} {
+		result, err := v.Verify(loadTestPolicy(t, tt.policy))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if !result.Passed() {
+			t.Fatalf("%s: expected the policy to pass", tt.policy)
+		}
+		if got := ruleNames(result); !slices.Equal(got, tt.rules) {
+			t.Errorf("%s: verified rules %v, want %v", tt.policy, got, tt.rules)
+		}
+	}
+
+	// The untar statement recorded by the runs above must not be visible to
+	// a policy that has no untar rule of its own.
+	pd := loadTestPolicy(t, "rule-references.yaml")
+	pd.AttestationRules = slices.DeleteFunc(pd.AttestationRules, func(r *models.AttestationRule) bool {
+		return r.Name == "untar"
+	})
+	result, err := v.Verify(pd)
+	if err == nil && result.Passed() {
+		t.Fatal("expected an expression referring to untar to fail without an untar rule")
+	}
+}
+
+func TestVerifyPoliciesConcurrently(t *testing.T) {
+	v := newTestVerifier(t)
+	policyDocuments := map[string]models.PolicyDocument{
+		"policy.yaml":          loadTestPolicy(t, "policy.yaml"),
+		"rule-references.yaml": loadTestPolicy(t, "rule-references.yaml"),
+	}
+	want := map[string][]string{
+		"policy.yaml":          {"build_external", "build_main", "build_testy", "untar"},
+		"rule-references.yaml": {"build_main", "untar"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for name, pd := range policyDocuments {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := v.Verify(pd)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					return
+				}
+				if !result.Passed() {
+					t.Errorf("%s: expected the policy to pass", name)
+				}
+				if got := ruleNames(result); !slices.Equal(got, want[name]) {
+					t.Errorf("%s: verified rules %v, want %v", name, got, want[name])
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
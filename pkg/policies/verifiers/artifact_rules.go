@@ -1,60 +1,83 @@
 package verifiers
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"maps"
-	"reflect"
-	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
 	"github.com/alecthomas/participle/v2"
-	lpb "github.com/in-toto/attestation/go/predicates/link/v0"
 	ita "github.com/in-toto/attestation/go/v1"
-	"github.com/stoewer/go-strcase"
 )
 
 type ArtifactRule interface{ value() }
 
 type Require struct {
-	Pattern string `"REQUIRE" @String`
+	Pattern Pattern `parser:"\"REQUIRE\" @@"`
 }
 
 func (f Require) value() {}
 
 type Allow struct {
-	Pattern string `"ALLOW" @String`
+	Pattern Pattern `parser:"\"ALLOW\" @@"`
 }
 
 func (f Allow) value() {}
 
 type Disallow struct {
-	Pattern string `"DISALLOW" @String`
+	Pattern Pattern `parser:"\"DISALLOW\" @@"`
 }
 
 func (f Disallow) value() {}
 
 type Match struct {
-	Pattern           string  `"MATCH" @String`
-	SourcePrefix      *string `("IN" @String)?`
-	Field             string  `"WITH" @String`
-	DestinationPrefix *string `("IN" @String)?`
+	Pattern           Pattern  `parser:"\"MATCH\" @@"`
+	SourcePrefix      *string  `parser:"(\"IN\" @String)?"`
+	Field             string   `parser:"\"WITH\" @String"`
+	DestinationPrefix *string  `parser:"(\"IN\" @String)?"`
+	On                []string `parser:"(\"ON\" @Ident (\",\" @Ident)*)?"`
 }
 
 func (f Match) value() {}
 
 type Mismatch struct {
-	Pattern           string  `"MISMATCH" @String`
-	SourcePrefix      *string `("IN" @String)?`
-	Field             string  `"WITH" @String`
-	DestinationPrefix *string `("IN" @String)?`
+	Pattern           Pattern  `parser:"\"MISMATCH\" @@"`
+	SourcePrefix      *string  `parser:"(\"IN\" @String)?"`
+	Field             string   `parser:"\"WITH\" @String"`
+	DestinationPrefix *string  `parser:"(\"IN\" @String)?"`
+	On                []string `parser:"(\"ON\" @Ident (\",\" @Ident)*)?"`
 }
 
 func (f Mismatch) value() {}
 
+type Create struct {
+	Pattern Pattern `parser:"\"CREATE\" @@"`
+}
+
+func (f Create) value() {}
+
+type Delete struct {
+	Pattern Pattern `parser:"\"DELETE\" @@"`
+}
+
+func (f Delete) value() {}
+
+type Modify struct {
+	Pattern Pattern `parser:"\"MODIFY\" @@"`
+}
+
+func (f Modify) value() {}
+
+// Include stands for the rules of an imported rule set, which are expanded
+// when the policy document is loaded.
+type Include struct {
+	RuleSet string `parser:"\"INCLUDE\" @String"`
+}
+
+func (f Include) value() {}
+
 var (
 	arParser = participle.MustBuild[ArtifactRule](
 		participle.Union[ArtifactRule](
@@ -63,36 +86,54 @@ var (
 			Disallow{},
 			Match{},
 			Mismatch{},
+			Create{},
+			Delete{},
+			Modify{},
+			Include{},
 		),
 		participle.UseLookahead(1024),
 		participle.Unquote("String"),
 	)
-	fieldArtifacts map[string]map[string]*ita.ResourceDescriptor = make(map[string]map[string]*ita.ResourceDescriptor)
 )
 
-func verifyArtifactRules(s *ita.Statement, ar *models.ArtifactRules, rule_name string) error {
+func verifyArtifactRules(session *Session, s *ita.Statement, ar *models.ArtifactRules, rule_name string) error {
 	rds, err := getArtifactResourceDescriptors(s, ar.Field)
 	if err != nil {
 		return err
 	}
 	rdsCopy := maps.Clone(rds)
 
+	t := session.tracer(ar.Field)
+	defer session.recordTraces(rule_name, t)
+
+	var before, after map[string]*ita.ResourceDescriptor
 	for _, r := range ar.Rules {
 		rule, err := arParser.ParseString("", r)
 		if err != nil {
 			return err
 		}
+		t.setRule(r)
 		switch r := (*rule).(type) {
 		case Require:
-			err = applyRequireRule(r, rds)
+			err = applyRequireRule(session, t, r, rds)
 		case Allow:
-			err = applyAllowRule(r, rds)
+			err = applyAllowRule(session, t, r, rds)
 		case Disallow:
-			err = applyDisallowRule(r, rds)
+			err = applyDisallowRule(session, t, r, rds)
 		case Match:
-			err = applyMatchRule(r, rds)
+			err = applyMatchRule(session, t, r, ar.DigestAlgorithms, rds)
 		case Mismatch:
-			err = applyMismatchRule(r, rds)
+			err = applyMismatchRule(session, t, r, ar.DigestAlgorithms, rds)
+		case Create, Delete, Modify:
+			if before == nil {
+				before, after, err = resolveChangeFields(session, s, ar, rdsCopy)
+				if err != nil {
+					return err
+				}
+			}
+			err = applyChangeRule(session, t, r, ar.DigestAlgorithms, before, after, rds)
+		case Include:
+			err = fmt.Errorf("rule set %s is not expanded", r.RuleSet)
 		default:
 			err = errors.New("Unknown artifact rule type")
 		}
@@ -100,57 +141,11 @@ func verifyArtifactRules(s *ita.Statement, ar *models.ArtifactRules, rule_name s
 			return err
 		}
 	}
-	fieldArtifacts[formatFieldArtifactName(rule_name, ar.Field)] = rdsCopy
+	t.remaining(rds)
+	session.recordArtifacts(formatFieldArtifactName(rule_name, ar.Field), rdsCopy)
 	return nil
 }
 
-func getArtifactResourceDescriptors(s *ita.Statement, field string) (map[string]*ita.ResourceDescriptor, error) {
-	var rs, rd reflect.Value
-	formattedField := formatFieldPath(field)
-	if strings.HasPrefix(formattedField, "Predicate.") {
-		// Maybe more powerful reflection like what CEL uses so there's no need for this
-		formattedField = strings.TrimPrefix(formattedField, "Predicate.")
-		switch s.PredicateType {
-		case "https://in-toto.io/attestation/link/v0.3":
-			var link lpb.Link
-			data, err := s.Predicate.MarshalJSON()
-			if err != nil {
-				return nil, err
-			}
-			err = json.Unmarshal(data, &link)
-			if err != nil {
-				return nil, err
-			}
-			rs = reflect.ValueOf(&link)
-		default:
-			return nil, errors.New("unsupported predicate type")
-		}
-	} else {
-		rs = reflect.ValueOf(s)
-	}
-	rd = reflect.Indirect(rs).FieldByName(formattedField)
-	if !rd.IsValid() {
-		return nil, fmt.Errorf("statement field does not exist: %s", field)
-	}
-	rds, successful := rd.Interface().([]*ita.ResourceDescriptor)
-	if !successful {
-		return nil, fmt.Errorf("statement field is not a collection of resource descriptor: %s", field)
-	}
-	rds_map := make(map[string]*ita.ResourceDescriptor)
-	for _, rd := range rds {
-		rds_map[rd.Name] = rd
-	}
-	return rds_map, nil
-}
-
-func formatFieldPath(field string) string {
-	fields := strings.Split(strings.TrimPrefix(field, "this."), ".")
-	for i, f := range fields {
-		fields[i] = strcase.UpperCamelCase(f)
-	}
-	return strings.Join(fields, ".")
-}
-
 func formatFieldArtifactName(ruleName, field string) string {
 	if strings.HasPrefix(field, "this.") {
 		return strings.Replace(field, "this", ruleName, 1)
@@ -158,13 +153,15 @@ func formatFieldArtifactName(ruleName, field string) string {
 	return ruleName + "." + field
 }
 
-func applyRequireRule(r Require, rds map[string]*ita.ResourceDescriptor) error {
+func applyRequireRule(session *Session, t *tracer, r Require, rds map[string]*ita.ResourceDescriptor) error {
 	seen := false
 	err := independentRuleCheck(
+		session,
+		t,
 		r.Pattern,
 		rds,
 		func(name string, rds map[string]*ita.ResourceDescriptor) error {
-			delete(rds, r.Pattern)
+			delete(rds, name)
 			seen = true
 			return nil
 		})
@@ -174,22 +171,33 @@ func applyRequireRule(r Require, rds map[string]*ita.ResourceDescriptor) error {
 	if seen {
 		return nil
 	}
-	return fmt.Errorf("did match with required resource pattern '%s'", r.Pattern)
+	return fmt.Errorf("did not match with required resource pattern '%s'", r.Pattern)
 }
 
-func applyAllowRule(a Allow, rds map[string]*ita.ResourceDescriptor) error {
+func applyAllowRule(session *Session, t *tracer, a Allow, rds map[string]*ita.ResourceDescriptor) error {
 	return independentRuleCheck(
+		session,
+		t,
 		a.Pattern,
 		rds,
 		func(name string, rds map[string]*ita.ResourceDescriptor) error {
-			delete(rds, a.Pattern)
+			delete(rds, name)
 			return nil
 		})
 }
 
-func applyDisallowRule(d Disallow, rds map[string]*ita.ResourceDescriptor) error {
+func applyDisallowRule(session *Session, t *tracer, d Disallow, rds map[string]*ita.ResourceDescriptor) error {
+	p := d.Pattern
+	if p.rejectsAll() {
+		// A bare DISALLOW "*" closes off the rules of policies written before
+		// * stopped matching across directories, so it keeps rejecting every
+		// remaining artifact.
+		p.Value = "**"
+	}
 	return independentRuleCheck(
-		d.Pattern,
+		session,
+		t,
+		p,
 		rds,
 		func(name string, rds map[string]*ita.ResourceDescriptor) error {
 			return fmt.Errorf(
@@ -200,114 +208,232 @@ func applyDisallowRule(d Disallow, rds map[string]*ita.ResourceDescriptor) error
 		})
 }
 
-func independentRuleCheck(p string, rds map[string]*ita.ResourceDescriptor, f func(string, map[string]*ita.ResourceDescriptor) error) (err error) {
-	if !strings.Contains(p, "*") {
-		if _, ok := rds[p]; ok {
-			err = f(p, rds)
-			if err != nil {
-				return
-			}
+// independentRuleCheck calls f for every queued artifact matching the
+// pattern and traces whether f consumed or rejected it.
+func independentRuleCheck(session *Session, t *tracer, p Pattern, rds map[string]*ita.ResourceDescriptor, f func(string, map[string]*ita.ResourceDescriptor) error) error {
+	names := []string{p.Value}
+	if !p.literal() {
+		names = sortedNames(rds)
+	}
+	for _, name := range names {
+		if _, ok := rds[name]; !ok {
+			continue
 		}
-	} else {
-		pattern := strings.Replace(p, "*", ".*", -1)
-		for name := range rds {
-			match, err := regexp.MatchString(pattern, name)
-			if err != nil {
-				return err
-			}
-			if match {
-				err = f(name, rds)
-				if err != nil {
-					return err
-				}
-			}
+		match, err := session.match(p, name)
+		if err != nil {
+			return err
+		}
+		if !match {
+			continue
+		}
+		if err := f(name, rds); err != nil {
+			t.record(name, ArtifactRejected, err.Error())
+			return err
+		}
+		if _, ok := rds[name]; !ok {
+			t.record(name, ArtifactConsumed, "")
 		}
 	}
 	return nil
 }
 
-func applyMatchRule(m Match, rds map[string]*ita.ResourceDescriptor) error {
+// resolveChangeFields returns the artifacts of the before and after fields
+// of an artifact rules policy, where the unset one is the queued field.
+func resolveChangeFields(session *Session, s *ita.Statement, ar *models.ArtifactRules, field map[string]*ita.ResourceDescriptor) (before, after map[string]*ita.ResourceDescriptor, err error) {
+	if ar.Before == "" && ar.After == "" {
+		return nil, nil, errors.New("CREATE, DELETE and MODIFY rules require a before or after field")
+	}
+	resolve := func(name string) (map[string]*ita.ResourceDescriptor, error) {
+		if name == "" || name == ar.Field {
+			return field, nil
+		}
+		if strings.HasPrefix(name, "this.") {
+			return getArtifactResourceDescriptors(s, name)
+		}
+		rds, ok := session.artifacts(name)
+		if !ok {
+			return nil, fmt.Errorf("no artifacts recorded for field: %s", name)
+		}
+		return rds, nil
+	}
+	if before, err = resolve(ar.Before); err != nil {
+		return nil, nil, err
+	}
+	if after, err = resolve(ar.After); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+// applyChangeRule consumes the queued artifacts matching the rule's pattern
+// that were created, deleted or modified between before and after.
+func applyChangeRule(session *Session, t *tracer, r ArtifactRule, algorithms []string, before, after, rds map[string]*ita.ResourceDescriptor) error {
+	c, err := newComparison([]string{"digest"}, algorithms)
+	if err != nil {
+		return err
+	}
+	var pattern Pattern
+	var change string
+	var changed func(b, a *ita.ResourceDescriptor) bool
+	switch r := r.(type) {
+	case Create:
+		pattern, change = r.Pattern, "created"
+		changed = func(b, a *ita.ResourceDescriptor) bool { return b == nil && a != nil }
+	case Delete:
+		pattern, change = r.Pattern, "deleted"
+		changed = func(b, a *ita.ResourceDescriptor) bool { return b != nil && a == nil }
+	case Modify:
+		pattern, change = r.Pattern, "modified"
+		changed = func(b, a *ita.ResourceDescriptor) bool {
+			return b != nil && a != nil && !c.equal(b, a)
+		}
+	}
+	return independentRuleCheck(
+		session,
+		t,
+		pattern,
+		rds,
+		func(name string, rds map[string]*ita.ResourceDescriptor) error {
+			if changed(before[name], after[name]) {
+				delete(rds, name)
+			} else {
+				t.record(name, ArtifactKept, "artifact was not "+change)
+			}
+			return nil
+		})
+}
+
+func applyMatchRule(session *Session, t *tracer, m Match, algorithms []string, rds map[string]*ita.ResourceDescriptor) error {
+	c, err := newComparison(m.On, algorithms)
+	if err != nil {
+		return err
+	}
 	return relationalRuleCheck(
+		session,
+		t,
 		m.Pattern,
 		m.Field,
 		m.SourcePrefix,
 		m.DestinationPrefix,
+		c,
 		rds,
-		func(rd1, rd2 *ita.ResourceDescriptor, rds map[string]*ita.ResourceDescriptor, name string) error {
-			if equalResourceDescriptor(rd1, rd2) {
+		func(equal bool, rds map[string]*ita.ResourceDescriptor, name string) error {
+			if equal {
 				delete(rds, name)
 			}
 			return nil
 		})
 }
 
-func applyMismatchRule(m Mismatch, rds map[string]*ita.ResourceDescriptor) error {
+func applyMismatchRule(session *Session, t *tracer, m Mismatch, algorithms []string, rds map[string]*ita.ResourceDescriptor) error {
+	c, err := newComparison(m.On, algorithms)
+	if err != nil {
+		return err
+	}
 	return relationalRuleCheck(
+		session,
+		t,
 		m.Pattern,
 		m.Field,
 		m.SourcePrefix,
 		m.DestinationPrefix,
+		c,
 		rds,
-		func(rd1, rd2 *ita.ResourceDescriptor, rds map[string]*ita.ResourceDescriptor, name string) error {
-			if !equalResourceDescriptor(rd1, rd2) {
+		func(equal bool, rds map[string]*ita.ResourceDescriptor, name string) error {
+			if !equal {
 				delete(rds, name)
 			}
 			return nil
 		})
 }
 
-func relationalRuleCheck(p, field string, sp, dp *string, rds map[string]*ita.ResourceDescriptor, f func(*ita.ResourceDescriptor, *ita.ResourceDescriptor, map[string]*ita.ResourceDescriptor, string) error) error {
-	if !strings.Contains(p, "*") {
-		srcPattern := p
-		destPattern := srcPattern
-		if sp != nil {
-			srcPattern = *sp + srcPattern
-		}
-		if dp != nil {
-			destPattern = *dp + srcPattern
+// relationalRuleCheck compares every queued artifact whose name, relative to
+// the source prefix, matches the pattern with the artifacts under the
+// destination prefix of the given field. Artifacts are paired by their
+// relative name if the comparison includes names, otherwise f learns
+// whether any destination artifact is equal. f is not called for artifacts
+// without a counterpart.
+func relationalRuleCheck(session *Session, t *tracer, p Pattern, field string, sp, dp *string, c *comparison, rds map[string]*ita.ResourceDescriptor, f func(bool, map[string]*ita.ResourceDescriptor, string) error) error {
+	destRds, ok := session.artifacts(field)
+	if !ok {
+		return fmt.Errorf("no artifacts recorded for field: %s", field)
+	}
+	for _, srcName := range sortedNames(rds) {
+		name, ok := trimPrefix(srcName, sp)
+		if !ok {
+			continue
 		}
-		srcRd, srcOk := rds[srcPattern]
-		destRd, destOk := fieldArtifacts[field][destPattern]
-		if srcOk && destOk {
-			f(srcRd, destRd, rds, srcPattern)
+		match, err := session.match(p, name)
+		if err != nil {
+			return err
 		}
-	} else {
-		srcPattern := strings.Replace(p, "*", ".*", -1)
-		if sp != nil {
-			srcPattern = *sp + srcPattern
+		if !match {
+			continue
 		}
-		for srcName, srcRd := range rds {
-			match, err := regexp.MatchString(srcPattern, srcName)
-			if err != nil {
-				return err
+
+		srcRd := rds[srcName]
+		var difference string
+		if c.byName() {
+			destName := name
+			if dp != nil && *dp != "" {
+				destName = prefixDir(*dp) + name
 			}
-			if match {
-				destPattern := srcName
-				if sp != nil {
-					destPattern = strings.TrimPrefix(destPattern, *sp)
-				}
-				if dp != nil {
-					destPattern = *dp + srcPattern
+			destRd, ok := destRds[destName]
+			if !ok {
+				t.record(srcName, ArtifactKept, fmt.Sprintf("destination missing: %s in %s", destName, field))
+				continue
+			}
+			difference = c.difference(srcRd, destRd)
+		} else {
+			candidates := false
+			difference = "no equal destination artifact in " + field
+			for _, destName := range sortedNames(destRds) {
+				if _, ok := trimPrefix(destName, dp); !ok {
+					continue
 				}
-				destRd, destOk := fieldArtifacts[field][destPattern]
-				if destOk {
-					f(srcRd, destRd, rds, srcPattern)
+				candidates = true
+				if c.equal(srcRd, destRds[destName]) {
+					difference = ""
+					break
 				}
 			}
+			if !candidates {
+				t.record(srcName, ArtifactKept, "no destination artifacts in "+field)
+				continue
+			}
+		}
+
+		if err := f(difference == "", rds, srcName); err != nil {
+			return err
+		}
+		switch _, kept := rds[srcName]; {
+		case !kept:
+			t.record(srcName, ArtifactConsumed, "")
+		case difference == "":
+			t.record(srcName, ArtifactKept, "destination is equal")
+		default:
+			t.record(srcName, ArtifactKept, difference)
 		}
 	}
 	return nil
 }
 
-func equalResourceDescriptor(rd1, rd2 *ita.ResourceDescriptor) bool {
-	if rd1 == rd2 {
-		return true
+func sortedNames(rds map[string]*ita.ResourceDescriptor) []string {
+	names := make([]string, 0, len(rds))
+	for name := range rds {
+		names = append(names, name)
 	}
-	// Not comparing annotations
-	return rd1.Name == rd2.Name &&
-		rd1.Uri == rd2.Uri &&
-		reflect.DeepEqual(rd1.Digest, rd2.Digest) &&
-		bytes.Equal(rd1.Content, rd2.Content) &&
-		rd1.DownloadLocation == rd2.DownloadLocation &&
-		rd1.MediaType == rd2.MediaType
+	slices.Sort(names)
+	return names
+}
+
+func trimPrefix(name string, prefix *string) (string, bool) {
+	if prefix == nil || *prefix == "" {
+		return name, true
+	}
+	return strings.CutPrefix(name, prefixDir(*prefix))
+}
+
+func prefixDir(prefix string) string {
+	return strings.TrimSuffix(prefix, "/") + "/"
 }
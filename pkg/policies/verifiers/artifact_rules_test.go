@@ -0,0 +1,156 @@
+package verifiers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+func TestChangeRules(t *testing.T) {
+	sha256a := map[string]string{"sha256": strings.Repeat("a", 64)}
+	sha256b := map[string]string{"sha256": strings.Repeat("b", 64)}
+	descriptors := func(digests map[string]map[string]string) []*ita.ResourceDescriptor {
+		var rds []*ita.ResourceDescriptor
+		for _, name := range []string{"kept", "modified", "deleted", "created"} {
+			if digest, ok := digests[name]; ok {
+				rds = append(rds, &ita.ResourceDescriptor{Name: name, Digest: digest})
+			}
+		}
+		return rds
+	}
+	materials := descriptors(map[string]map[string]string{"kept": sha256a, "modified": sha256a, "deleted": sha256a})
+	products := descriptors(map[string]map[string]string{"kept": sha256a, "modified": sha256b, "created": sha256a})
+
+	tests := []struct {
+		name string
+		// queued is this.subject, other is recorded as build.other and
+		// used as before or after.
+		queued, other []*ita.ResourceDescriptor
+		before, after string
+		rules         []string
+		wantErr       string
+	}{
+		{
+			name:   "CREATE consumes created products",
+			queued: products, other: materials, before: "build.other",
+			rules: []string{`CREATE "**"`, `ALLOW "kept"`, `ALLOW "modified"`, `DISALLOW "**"`},
+		},
+		{
+			name:   "CREATE leaves modified products",
+			queued: products, other: materials, before: "build.other",
+			rules:   []string{`CREATE "**"`, `ALLOW "kept"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': modified",
+		},
+		{
+			name:   "MODIFY consumes products with a different digest",
+			queued: products, other: materials, before: "build.other",
+			rules: []string{`MODIFY "**"`, `ALLOW "kept"`, `ALLOW "created"`, `DISALLOW "**"`},
+		},
+		{
+			name:   "MODIFY leaves unchanged products",
+			queued: products, other: materials, before: "build.other",
+			rules:   []string{`MODIFY "**"`, `ALLOW "created"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': kept",
+		},
+		{
+			name:   "MODIFY leaves created products",
+			queued: products, other: materials, before: "build.other",
+			rules:   []string{`MODIFY "**"`, `ALLOW "kept"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': created",
+		},
+		{
+			name:   "DELETE consumes deleted materials",
+			queued: materials, other: products, after: "build.other",
+			rules: []string{`DELETE "**"`, `ALLOW "kept"`, `ALLOW "modified"`, `DISALLOW "**"`},
+		},
+		{
+			name:   "DELETE leaves modified materials",
+			queued: materials, other: products, after: "build.other",
+			rules:   []string{`DELETE "**"`, `ALLOW "kept"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': modified",
+		},
+		{
+			name:   "MODIFY on materials against the products",
+			queued: materials, other: products, after: "build.other",
+			rules: []string{`MODIFY "modified"`, `ALLOW "kept"`, `ALLOW "deleted"`, `DISALLOW "**"`},
+		},
+		// An artifact deleted and created again at the same path is in both
+		// fields, so it is modified rather than deleted or created.
+		{
+			name:    "CREATE of a recreated artifact",
+			queued:  []*ita.ResourceDescriptor{{Name: "out", Digest: sha256b}},
+			other:   []*ita.ResourceDescriptor{{Name: "out", Digest: sha256a}},
+			before:  "build.other",
+			rules:   []string{`CREATE "out"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': out",
+		},
+		{
+			name:    "DELETE of a recreated artifact",
+			queued:  []*ita.ResourceDescriptor{{Name: "out", Digest: sha256a}},
+			other:   []*ita.ResourceDescriptor{{Name: "out", Digest: sha256b}},
+			after:   "build.other",
+			rules:   []string{`DELETE "out"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': out",
+		},
+		{
+			name:   "MODIFY of a recreated artifact",
+			queued: []*ita.ResourceDescriptor{{Name: "out", Digest: sha256b}},
+			other:  []*ita.ResourceDescriptor{{Name: "out", Digest: sha256a}},
+			before: "build.other",
+			rules:  []string{`MODIFY "out"`, `DISALLOW "**"`},
+		},
+		{
+			name:    "recreated with the same digest is unchanged",
+			queued:  []*ita.ResourceDescriptor{{Name: "out", Digest: sha256a}},
+			other:   []*ita.ResourceDescriptor{{Name: "out", Digest: sha256a}},
+			before:  "build.other",
+			rules:   []string{`CREATE "out"`, `MODIFY "out"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': out",
+		},
+		{
+			name:    "no before or after field",
+			queued:  products,
+			rules:   []string{`CREATE "**"`},
+			wantErr: "CREATE, DELETE and MODIFY rules require a before or after field",
+		},
+		{
+			name:   "unrecorded before field",
+			queued: products, before: "missing.materials",
+			rules:   []string{`MODIFY "**"`},
+			wantErr: "no artifacts recorded for field: missing.materials",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := make(map[string]*ita.ResourceDescriptor)
+			for _, rd := range tt.other {
+				other[rd.Name] = rd
+			}
+			session.recordArtifacts("build.other", other)
+			statement := &ita.Statement{
+				Type:          ita.StatementTypeUri,
+				Subject:       tt.queued,
+				PredicateType: "https://example.com/predicate",
+			}
+			ar := &models.ArtifactRules{
+				Field:  "this.subject",
+				Before: tt.before,
+				After:  tt.after,
+				Rules:  tt.rules,
+			}
+			err = verifyArtifactRules(session, statement, ar, "package")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
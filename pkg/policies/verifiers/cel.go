@@ -1,21 +1,66 @@
 package verifiers
 
 import (
+	"errors"
+	"reflect"
+
 	"github.com/google/cel-go/cel"
 	ita "github.com/in-toto/attestation/go/v1"
 )
 
-var celEnv *cel.Env
+// predicateOptions declares the `predicate` variable for statements of the
+// given predicate type, typed by its registered message so that expressions
+// are checked against the predicate's fields. Unregistered predicate types
+// are exposed as a map.
+func predicateOptions(predicateType string) []cel.EnvOption {
+	newMessage, ok := lookupPredicateType(predicateType)
+	if !ok {
+		return []cel.EnvOption{cel.Variable("predicate", cel.MapType(cel.StringType, cel.DynType))}
+	}
+	m := newMessage()
+	return []cel.EnvOption{
+		cel.Types(m),
+		cel.Variable("predicate", cel.ObjectType(string(m.ProtoReflect().Descriptor().FullName()))),
+	}
+}
+
+// predicateValue returns the value bound to `predicate` for a statement.
+func predicateValue(s *ita.Statement) (any, error) {
+	predicate, err := decodePredicate(s)
+	if err != nil || predicate != nil {
+		return predicate, err
+	}
+	return s.Predicate, nil
+}
+
+func newCelEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Types(&ita.Statement{}),
+		cel.Variable("this", cel.ObjectType("in_toto_attestation.v1.Statement")),
+	)
+}
 
-func initializeCelEnv() (err error) {
-	if celEnv == nil {
-		celEnv, err = cel.NewEnv(
-			cel.Types(&ita.Statement{}),
-			cel.Variable("this", cel.ObjectType("in_toto_attestation.v1.Statement")),
-		)
-		if err != nil {
-			return
-		}
-	}
-	return nil
+// EvaluateSelector evaluates a CEL expression over the statement bound to
+// `this` and reports whether it holds.
+func EvaluateSelector(expression string, s *ita.Statement) (bool, error) {
+	env, err := newCelEnv()
+	if err != nil {
+		return false, err
+	}
+	ast, issues := env.Compile(expression)
+	if err := issues.Err(); err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(ast.OutputType(), cel.BoolType) {
+		return false, errors.New("selector expression must resolve to a boolean")
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := program.Eval(map[string]any{"this": s})
+	if err != nil {
+		return false, err
+	}
+	return out.Value().(bool), nil
 }
@@ -0,0 +1,123 @@
+package verifiers
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+// defaultDigestAlgorithms are the digest algorithms compared when an
+// artifact rules policy does not choose its own.
+var defaultDigestAlgorithms = []string{
+	"sha224", "sha256", "sha384", "sha512", "sha512_224", "sha512_256",
+	"sha3_224", "sha3_256", "sha3_384", "sha3_512",
+	"shake128", "shake256", "blake2b", "blake2s",
+}
+
+var weakDigestAlgorithms = []string{"md5", "sha1"}
+
+var resourceDescriptorAttributes = []string{"name", "uri", "digest", "content", "downloadLocation", "mediaType"}
+
+// comparison decides whether two resource descriptors are the same artifact
+// by the attributes a MATCH or MISMATCH rule is ON.
+type comparison struct {
+	attributes []string
+	algorithms []string
+	// requireDigest is set when the rule is explicitly ON digest, so that
+	// artifacts without digests do not match.
+	requireDigest bool
+}
+
+// newComparison defaults to comparing every attribute but annotations, and
+// artifacts are only paired by name when the name is compared.
+func newComparison(on, algorithms []string) (*comparison, error) {
+	for _, a := range on {
+		if !slices.Contains(resourceDescriptorAttributes, a) {
+			return nil, fmt.Errorf("unknown resource descriptor attribute: %s", a)
+		}
+	}
+	requireDigest := slices.Contains(on, "digest")
+	if len(on) == 0 {
+		on = resourceDescriptorAttributes
+	}
+	if len(algorithms) == 0 {
+		algorithms = defaultDigestAlgorithms
+	}
+	for _, a := range algorithms {
+		if slices.Contains(weakDigestAlgorithms, a) {
+			return nil, fmt.Errorf("digest algorithm is too weak to match artifacts: %s", a)
+		}
+	}
+	return &comparison{attributes: on, algorithms: algorithms, requireDigest: requireDigest}, nil
+}
+
+func (c *comparison) byName() bool {
+	return slices.Contains(c.attributes, "name")
+}
+
+func (c *comparison) equal(rd1, rd2 *ita.ResourceDescriptor) bool {
+	return c.difference(rd1, rd2) == ""
+}
+
+// difference describes the first compared attribute two resource
+// descriptors differ in, or returns "" if they are equal.
+func (c *comparison) difference(rd1, rd2 *ita.ResourceDescriptor) string {
+	if rd1 == rd2 {
+		return ""
+	}
+	// Names are compared by pairing artifacts, relative to their prefixes
+	for _, a := range c.attributes {
+		var equal bool
+		switch a {
+		case "name":
+			equal = true
+		case "uri":
+			equal = rd1.Uri == rd2.Uri
+		case "digest":
+			if d := c.digestDifference(rd1.Digest, rd2.Digest); d != "" {
+				return d
+			}
+			equal = true
+		case "content":
+			equal = bytes.Equal(rd1.Content, rd2.Content)
+		case "downloadLocation":
+			equal = rd1.DownloadLocation == rd2.DownloadLocation
+		case "mediaType":
+			equal = rd1.MediaType == rd2.MediaType
+		}
+		if !equal {
+			return a + " differs"
+		}
+	}
+	return ""
+}
+
+// digestDifference requires the digests to share at least one allowed
+// algorithm and to agree on every allowed algorithm they share. Digests that
+// are both empty are only equal when the rule is not explicitly ON digest.
+func (c *comparison) digestDifference(d1, d2 map[string]string) string {
+	if len(d1) == 0 && len(d2) == 0 {
+		if c.requireDigest {
+			return "digest missing"
+		}
+		return ""
+	}
+	common := false
+	for _, a := range c.algorithms {
+		v1, ok1 := d1[a]
+		v2, ok2 := d2[a]
+		if !ok1 || !ok2 {
+			continue
+		}
+		if v1 != v2 {
+			return a + " digest differs"
+		}
+		common = true
+	}
+	if !common {
+		return "no common allowed digest algorithm"
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package verifiers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+func TestComparison(t *testing.T) {
+	sha256a := map[string]string{"sha256": strings.Repeat("a", 64)}
+	sha256b := map[string]string{"sha256": strings.Repeat("b", 64)}
+	tests := []struct {
+		name       string
+		on         []string
+		algorithms []string
+		rd1, rd2   *ita.ResourceDescriptor
+		want       string
+	}{
+		{
+			name: "equal by default",
+			rd1:  &ita.ResourceDescriptor{Name: "a", Digest: sha256a, Uri: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{Name: "b", Digest: sha256a, Uri: "https://example.com/a"},
+		},
+		{
+			name: "uri differs by default",
+			rd1:  &ita.ResourceDescriptor{Digest: sha256a, Uri: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{Digest: sha256a, Uri: "https://example.com/b"},
+			want: "uri differs",
+		},
+		{
+			name: "ON digest ignores the uri",
+			on:   []string{"digest"},
+			rd1:  &ita.ResourceDescriptor{Digest: sha256a, Uri: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{Digest: sha256a, Uri: "https://example.com/b"},
+		},
+		{
+			name: "ON uri ignores the digest",
+			on:   []string{"uri"},
+			rd1:  &ita.ResourceDescriptor{Digest: sha256a, Uri: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{Digest: sha256b, Uri: "https://example.com/a"},
+		},
+		{
+			name: "ON digest with differing digests",
+			on:   []string{"digest"},
+			rd1:  &ita.ResourceDescriptor{Digest: sha256a},
+			rd2:  &ita.ResourceDescriptor{Digest: sha256b},
+			want: "sha256 digest differs",
+		},
+		{
+			name: "ON digest without digests",
+			on:   []string{"digest"},
+			rd1:  &ita.ResourceDescriptor{Uri: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{Uri: "https://example.com/a"},
+			want: "digest missing",
+		},
+		{
+			name: "default without digests",
+			rd1:  &ita.ResourceDescriptor{Content: []byte("a")},
+			rd2:  &ita.ResourceDescriptor{Content: []byte("a")},
+		},
+		{
+			name: "ON digest with only one digest",
+			on:   []string{"digest"},
+			rd1:  &ita.ResourceDescriptor{Digest: sha256a},
+			rd2:  &ita.ResourceDescriptor{},
+			want: "no common allowed digest algorithm",
+		},
+		{
+			name: "weak digests are not compared",
+			on:   []string{"digest"},
+			rd1:  &ita.ResourceDescriptor{Digest: map[string]string{"sha1": "aa"}},
+			rd2:  &ita.ResourceDescriptor{Digest: map[string]string{"sha1": "aa"}},
+			want: "no common allowed digest algorithm",
+		},
+		{
+			name:       "only chosen algorithms are compared",
+			on:         []string{"digest"},
+			algorithms: []string{"sha512"},
+			rd1:        &ita.ResourceDescriptor{Digest: sha256a},
+			rd2:        &ita.ResourceDescriptor{Digest: sha256a},
+			want:       "no common allowed digest algorithm",
+		},
+		{
+			name: "ON mediaType and downloadLocation",
+			on:   []string{"mediaType", "downloadLocation"},
+			rd1:  &ita.ResourceDescriptor{MediaType: "text/plain", DownloadLocation: "https://example.com/a"},
+			rd2:  &ita.ResourceDescriptor{MediaType: "text/plain", DownloadLocation: "https://example.com/b"},
+			want: "downloadLocation differs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newComparison(tt.on, tt.algorithms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.difference(tt.rd1, tt.rd2); got != tt.want {
+				t.Errorf("difference is %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparisonRejectsWeakAlgorithms(t *testing.T) {
+	for _, algorithms := range [][]string{{"md5"}, {"sha256", "sha1"}} {
+		if _, err := newComparison(nil, algorithms); err == nil || !strings.Contains(err.Error(), "too weak") {
+			t.Errorf("%v: expected a weak algorithm error, got: %v", algorithms, err)
+		}
+	}
+	if _, err := newComparison([]string{"annotations"}, nil); err == nil {
+		t.Error("expected an unknown attribute to be rejected")
+	}
+}
+
+func TestMatchOn(t *testing.T) {
+	sha256a := map[string]string{"sha256": strings.Repeat("a", 64)}
+	sha256b := map[string]string{"sha256": strings.Repeat("b", 64)}
+	statement := &ita.Statement{
+		Type: ita.StatementTypeUri,
+		Subject: []*ita.ResourceDescriptor{
+			{Name: "app", Digest: sha256a, Uri: "https://example.com/app"},
+			{Name: "renamed", Digest: sha256a},
+			{Name: "bare", Uri: "https://example.com/bare"},
+		},
+		PredicateType: "https://example.com/predicate",
+	}
+	build := map[string]*ita.ResourceDescriptor{
+		"app":  {Name: "app", Digest: sha256a, Uri: "https://example.com/other"},
+		"lib":  {Name: "lib", Digest: sha256b},
+		"bare": {Name: "bare", Uri: "https://example.com/bare"},
+	}
+
+	tests := []struct {
+		rule             string
+		digestAlgorithms []string
+		wantErr          string
+	}{
+		// The uri of app differs, so it only matches ON digest.
+		{rule: `MATCH "app" WITH "build.subject"`, wantErr: "disallowed resource pattern '**': app"},
+		{rule: `MATCH "app" WITH "build.subject" ON name, digest`},
+		// Without the name, any artifact of build with the same digest matches.
+		{rule: `MATCH "renamed" WITH "build.subject" ON digest`},
+		{rule: `MATCH "renamed" WITH "build.subject" ON name, digest`, wantErr: "disallowed resource pattern '**': renamed"},
+		// Artifacts without digests do not match ON digest.
+		{rule: `MATCH "bare" WITH "build.subject" ON name, digest`, wantErr: "disallowed resource pattern '**': bare"},
+		{rule: `MATCH "bare" WITH "build.subject" ON name, uri`},
+		{rule: `MATCH "bare" WITH "build.subject" ON uri`},
+		{rule: `MATCH "app" WITH "build.subject" ON name, digest`, digestAlgorithms: []string{"md5"}, wantErr: "digest algorithm is too weak to match artifacts: md5"},
+		{rule: `MATCH "app" WITH "build.subject" ON name, digest`, digestAlgorithms: []string{"sha1"}, wantErr: "digest algorithm is too weak to match artifacts: sha1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+strings.Join(tt.digestAlgorithms, ","), func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.recordArtifacts("build.subject", build)
+			// Only the artifact under test is left for the MATCH rule.
+			var rules []string
+			for _, rd := range statement.Subject {
+				if !strings.Contains(tt.rule, `"`+rd.Name+`"`) {
+					rules = append(rules, `ALLOW "`+rd.Name+`"`)
+				}
+			}
+			ar := &models.ArtifactRules{
+				Field:            "this.subject",
+				Rules:            append(rules, tt.rule, `DISALLOW "**"`),
+				DigestAlgorithms: tt.digestAlgorithms,
+			}
+			err = verifyArtifactRules(session, statement, ar, "package")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
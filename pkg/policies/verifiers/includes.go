@@ -0,0 +1,57 @@
+package verifiers
+
+import (
+	"fmt"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+)
+
+// ExpandIncludes returns the policy with every INCLUDE rule of an artifact
+// rules policy replaced by the rules of the named rule set. Rule sets cannot
+// include other rule sets. Policies without INCLUDE rules are returned as
+// is.
+func ExpandIncludes(policy *models.Policy, ruleSets map[string][]string) (*models.Policy, error) {
+	if policy.Type != ArtifactRulesPolicyType {
+		return policy, nil
+	}
+	var ar models.ArtifactRules
+	if err := decodeDefinition(policy, &ar); err != nil {
+		return nil, err
+	}
+	included := false
+	rules := make([]string, 0, len(ar.Rules))
+	for _, r := range ar.Rules {
+		name, ok := includedRuleSet(r)
+		if !ok {
+			rules = append(rules, r)
+			continue
+		}
+		set, ok := ruleSets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rule set: %s", name)
+		}
+		for _, r := range set {
+			if _, ok := includedRuleSet(r); ok {
+				return nil, fmt.Errorf("rule set %s includes another rule set", name)
+			}
+		}
+		rules = append(rules, set...)
+		included = true
+	}
+	if !included {
+		return policy, nil
+	}
+	ar.Rules = rules
+	return &models.Policy{Type: policy.Type, Definition: &ar}, nil
+}
+
+// includedRuleSet returns the rule set named by an INCLUDE rule. Rules that
+// do not parse are left for verification to report.
+func includedRuleSet(rule string) (string, bool) {
+	r, err := arParser.ParseString("", rule)
+	if err != nil {
+		return "", false
+	}
+	include, ok := (*r).(Include)
+	return include.RuleSet, ok
+}
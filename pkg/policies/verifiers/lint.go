@@ -0,0 +1,258 @@
+package verifiers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/google/cel-go/cel"
+)
+
+// Issue is a problem found by LintPolicy. Key is the dotted path of the
+// offending entry within the policy, e.g. "definition.rules", and Index its
+// position in that list, or -1 if the entry is not a list item.
+type Issue struct {
+	Key   string
+	Index int
+	Err   error
+}
+
+// ArtifactField returns the name under which an artifact rules policy of the
+// given attestation rule records its artifacts, which is what MATCH and
+// MISMATCH rules of later attestation rules refer to.
+func ArtifactField(policy *models.Policy, rule_name string) (string, bool) {
+	if policy.Type != ArtifactRulesPolicyType {
+		return "", false
+	}
+	var ar models.ArtifactRules
+	if err := decodeDefinition(policy, &ar); err != nil || ar.Field == "" {
+		return "", false
+	}
+	return formatFieldArtifactName(rule_name, ar.Field), true
+}
+
+// LintScope is what the policy of an attestation rule may refer to.
+type LintScope struct {
+	// Rules are the names of the other attestation rules and Fields the
+	// artifact fields they record.
+	Rules  []string
+	Fields map[string]bool
+	// Namespaces are the names of sub-policies. References into them are
+	// not checked.
+	Namespaces []string
+	// Parameters hold placeholder values of the policy parameters.
+	Parameters map[string]any
+	// Imports are the names of imported policy libraries, and Opaque the
+	// attestation rules whose fields are not known as they use imported
+	// policies.
+	Imports []string
+	Opaque  []string
+}
+
+// LintPolicy statically checks the policy of an attestation rule without
+// any attestation.
+func LintPolicy(policy *models.Policy, rule_name, predicateType string, scope *LintScope) []Issue {
+	switch policy.Type {
+	case ArtifactRulesPolicyType:
+		var ar models.ArtifactRules
+		if err := decodeDefinition(policy, &ar); err != nil {
+			return []Issue{{Key: "definition", Index: -1, Err: err}}
+		}
+		return lintArtifactRules(&ar, rule_name, scope)
+	case PredicateAttributePolicyType:
+		var pa models.PredicateAttribute
+		if err := decodeDefinition(policy, &pa); err != nil {
+			return []Issue{{Key: "definition", Index: -1, Err: err}}
+		}
+		return lintPredicateAttribute(&pa, predicateType, scope)
+	default:
+		return []Issue{{Key: "type", Index: -1, Err: fmt.Errorf("unsupported policy type: %s", policy.Type)}}
+	}
+}
+
+func lintArtifactRules(ar *models.ArtifactRules, rule_name string, scope *LintScope) []Issue {
+	var issues []Issue
+	if ar.Field == "" {
+		issues = append(issues, Issue{Key: "definition", Index: -1, Err: errors.New("artifact rules policy has no field")})
+	}
+	if _, err := newComparison(nil, ar.DigestAlgorithms); err != nil {
+		issues = append(issues, Issue{Key: "definition.digestAlgorithms", Index: -1, Err: err})
+	}
+	for _, key := range []string{"before", "after"} {
+		f := ar.Before
+		if key == "after" {
+			f = ar.After
+		}
+		if f == "" || strings.HasPrefix(f, "this.") {
+			continue
+		}
+		if err := lintArtifactTarget(f, rule_name, scope); err != nil {
+			issues = append(issues, Issue{Key: "definition." + key, Index: -1, Err: err})
+		}
+	}
+	for i, r := range ar.Rules {
+		r, err := substituteRule(r, scope.Parameters)
+		if err != nil {
+			issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+			continue
+		}
+		rule, err := arParser.ParseString("", r)
+		if err != nil {
+			issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+			continue
+		}
+		if err := lintPattern(*rule); err != nil {
+			issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+		}
+		if d, ok := (*rule).(Disallow); ok && d.Pattern.rejectsAll() {
+			issues = append(issues, Issue{
+				Key:   "definition.rules",
+				Index: i,
+				Err:   errors.New(`DISALLOW "*" is read as DISALLOW "**" and also rejects nested artifacts, write DISALLOW "**" instead`),
+			})
+		}
+		var target string
+		switch r := (*rule).(type) {
+		case Match:
+			target = r.Field
+			if _, err := newComparison(r.On, nil); err != nil {
+				issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+			}
+		case Mismatch:
+			target = r.Field
+			if _, err := newComparison(r.On, nil); err != nil {
+				issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+			}
+		case Include:
+			ns, _, _ := strings.Cut(r.RuleSet, ".")
+			if !slices.Contains(scope.Imports, ns) {
+				issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: fmt.Errorf("rule set does not name an import: %s", r.RuleSet)})
+			}
+			continue
+		case Create, Delete, Modify:
+			if ar.Before == "" && ar.After == "" {
+				issues = append(issues, Issue{
+					Key:   "definition.rules",
+					Index: i,
+					Err:   errors.New("CREATE, DELETE and MODIFY rules require a before or after field"),
+				})
+			}
+			continue
+		default:
+			continue
+		}
+		if err := lintArtifactTarget(target, rule_name, scope); err != nil {
+			issues = append(issues, Issue{Key: "definition.rules", Index: i, Err: err})
+		}
+	}
+	return issues
+}
+
+func lintPattern(rule ArtifactRule) error {
+	var p Pattern
+	switch r := rule.(type) {
+	case Require:
+		p = r.Pattern
+	case Allow:
+		p = r.Pattern
+	case Disallow:
+		p = r.Pattern
+	case Match:
+		p = r.Pattern
+	case Mismatch:
+		p = r.Pattern
+	case Create:
+		p = r.Pattern
+	case Delete:
+		p = r.Pattern
+	case Modify:
+		p = r.Pattern
+	}
+	if p.literal() {
+		return nil
+	}
+	_, err := p.compile()
+	return err
+}
+
+func lintArtifactTarget(target, rule_name string, scope *LintScope) error {
+	prefixes := qualifiedPrefixes(target)
+	if slices.Contains(scope.Namespaces, prefixes[0]) && len(prefixes) > 1 {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		if prefix == rule_name {
+			return fmt.Errorf("attestation rule cannot match with its own artifacts: %s", target)
+		}
+		if !slices.Contains(scope.Rules, prefix) {
+			continue
+		}
+		if !scope.Fields[target] && !slices.Contains(scope.Opaque, prefix) {
+			return fmt.Errorf("attestation rule %s records no artifact field %s", prefix, target)
+		}
+		return nil
+	}
+	return fmt.Errorf("artifact field does not name an attestation rule: %s", target)
+}
+
+func lintPredicateAttribute(pa *models.PredicateAttribute, predicateType string, scope *LintScope) []Issue {
+	env, err := newCelEnv()
+	if err == nil {
+		env, err = env.Extend(predicateOptions(predicateType)...)
+	}
+	if err == nil {
+		var opts []cel.EnvOption
+		if opts, err = parameterOptions(scope.Parameters); err == nil {
+			env, err = env.Extend(opts...)
+		}
+	}
+	if err != nil {
+		return []Issue{{Key: "definition", Index: -1, Err: err}}
+	}
+	for _, r := range scope.Rules {
+		if env, err = env.Extend(cel.Variable(r, cel.ObjectType("in_toto_attestation.v1.Statement"))); err != nil {
+			return []Issue{{Key: "definition", Index: -1, Err: err}}
+		}
+	}
+	for _, ns := range scope.Namespaces {
+		if env, err = env.Extend(cel.Variable(ns, cel.DynType)); err != nil {
+			return []Issue{{Key: "definition", Index: -1, Err: err}}
+		}
+	}
+
+	var issues []Issue
+	for i, e := range pa.Expressions {
+		ast, iss := env.Compile(e)
+		if err := iss.Err(); err != nil {
+			issues = append(issues, Issue{Key: "definition.expressions", Index: i, Err: err})
+			continue
+		}
+		if !reflect.DeepEqual(ast.OutputType(), cel.BoolType) {
+			issues = append(issues, Issue{
+				Key:   "definition.expressions",
+				Index: i,
+				Err:   fmt.Errorf("predicate attribute expression must resolve to a boolean, not %s", ast.OutputType()),
+			})
+		}
+	}
+	return issues
+}
+
+// CheckSelector compiles a match selector without evaluating it.
+func CheckSelector(expression string) error {
+	env, err := newCelEnv()
+	if err != nil {
+		return err
+	}
+	ast, issues := env.Compile(expression)
+	if err := issues.Err(); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(ast.OutputType(), cel.BoolType) {
+		return errors.New("selector expression must resolve to a boolean")
+	}
+	return nil
+}
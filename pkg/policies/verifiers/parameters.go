@@ -0,0 +1,159 @@
+package verifiers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/google/cel-go/cel"
+)
+
+var parameterReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// SubstituteParameters returns the policy with ${name} replaced by the value
+// of the parameter in the rules of an artifact rules policy. Other policies
+// are returned as is, they refer to parameters as params.<name>.
+func SubstituteParameters(policy *models.Policy, params map[string]any) (*models.Policy, error) {
+	if policy.Type != ArtifactRulesPolicyType {
+		return policy, nil
+	}
+	var ar models.ArtifactRules
+	if err := decodeDefinition(policy, &ar); err != nil {
+		return nil, err
+	}
+	rules := make([]string, len(ar.Rules))
+	for i, r := range ar.Rules {
+		rule, err := substituteRule(r, params)
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = rule
+	}
+	ar.Rules = rules
+	return &models.Policy{Type: policy.Type, Definition: &ar}, nil
+}
+
+// PatternParameter is the value of a parameter of type pattern. Unlike other
+// values, it is substituted into artifact rule patterns with its wildcards
+// intact.
+type PatternParameter string
+
+// substituteRule replaces parameter references in an artifact rule. Values
+// are escaped for the quoted strings of the rule they appear in, and within
+// the pattern of the rule they match literally unless they are a
+// PatternParameter.
+func substituteRule(rule string, params map[string]any) (string, error) {
+	var b strings.Builder
+	quoted, literals, regex := false, 0, false
+	start := 0
+	flush := func(end int) error {
+		inPattern := quoted && literals == 0 && !strings.HasPrefix(strings.TrimSpace(rule), "INCLUDE")
+		s, err := substituteText(rule, rule[start:end], params, inPattern, regex)
+		if err != nil {
+			return err
+		}
+		b.WriteString(s)
+		start = end
+		return nil
+	}
+	for i := 0; i < len(rule); i++ {
+		switch {
+		case quoted && rule[i] == '\\':
+			i++
+		case rule[i] == '"':
+			if err := flush(i); err != nil {
+				return "", err
+			}
+			if quoted {
+				literals++
+			} else if literals == 0 {
+				regex = slices.Contains(strings.Fields(rule[:i]), "REGEX")
+			}
+			quoted = !quoted
+		}
+	}
+	if err := flush(len(rule)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// substituteText replaces the parameter references in text, a part of rule
+// that lies entirely inside or outside of a quoted string.
+func substituteText(rule, text string, params map[string]any, inPattern, regex bool) (string, error) {
+	var err error
+	substituted := parameterReference.ReplaceAllStringFunc(text, func(ref string) string {
+		name := parameterReference.FindStringSubmatch(ref)[1]
+		v, ok := params[name]
+		if !ok {
+			err = fmt.Errorf("unknown parameter in artifact rule %q: %s", rule, name)
+			return ref
+		}
+		var value string
+		switch v := v.(type) {
+		case []string:
+			err = fmt.Errorf("list parameter cannot be substituted in artifact rule %q: %s", rule, name)
+			return ref
+		case PatternParameter:
+			value = string(v)
+		default:
+			value = fmt.Sprint(v)
+			switch {
+			case inPattern && regex:
+				value = regexp.QuoteMeta(value)
+			case inPattern:
+				value = EscapeGlob(value)
+			}
+		}
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	})
+	return substituted, err
+}
+
+// parameterOptions declares a params.<name> variable for every parameter,
+// typed by its value.
+func parameterOptions(params map[string]any) ([]cel.EnvOption, error) {
+	var opts []cel.EnvOption
+	for name, v := range params {
+		var t *cel.Type
+		switch v.(type) {
+		case string, PatternParameter:
+			t = cel.StringType
+		case int64:
+			t = cel.IntType
+		case bool:
+			t = cel.BoolType
+		case []string:
+			t = cel.ListType(cel.StringType)
+		default:
+			return nil, fmt.Errorf("unsupported type of parameter %s: %T", name, v)
+		}
+		opts = append(opts, cel.Variable("params."+name, t))
+	}
+	return opts, nil
+}
+
+// SetParameters makes the parameters of the policy available to CEL
+// expressions as params.<name>.
+func (s *Session) SetParameters(params map[string]any) error {
+	opts, err := parameterOptions(params)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env, err := s.celEnv.Extend(opts...)
+	if err != nil {
+		return err
+	}
+	s.celEnv = env
+	for name, v := range params {
+		if p, ok := v.(PatternParameter); ok {
+			v = string(p)
+		}
+		s.statements["params."+name] = v
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package verifiers
+
+import "testing"
+
+func TestSubstituteRule(t *testing.T) {
+	params := map[string]any{
+		"name":    "*",
+		"file":    `src/"a".c`,
+		"version": "1.0+rc",
+		"tree":    PatternParameter("src/**"),
+		"prefix":  "build/",
+		"list":    []string{"a"},
+	}
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{`DISALLOW "${name}"`, `DISALLOW "\\*"`, false},
+		{`REQUIRE "${file}"`, `REQUIRE "src/\"a\".c"`, false},
+		{`ALLOW REGEX "app-${version}\.tar"`, `ALLOW REGEX "app-1\\.0\\+rc\.tar"`, false},
+		{`DISALLOW "${tree}"`, `DISALLOW "src/**"`, false},
+		{`MATCH "${name}.o" IN "${prefix}" WITH "materials" IN "${name}"`, `MATCH "\\*.o" IN "build/" WITH "materials" IN "*"`, false},
+		{`INCLUDE "${prefix}"`, `INCLUDE "build/"`, false},
+		{`REQUIRE "${missing}"`, "", true},
+		{`REQUIRE "${list}"`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := substituteRule(tt.rule, params)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("%s: expected an error", tt.rule)
+		case !tt.wantErr && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.rule, err)
+		case got != tt.want:
+			t.Errorf("%s = %s, want %s", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestSubstitutedValueMatchesLiterally(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		value any
+		want  bool
+	}{
+		{"*", false},
+		{PatternParameter("*"), true},
+	} {
+		rule, err := substituteRule(`DISALLOW "${name}"`, map[string]any{"name": tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := arParser.ParseString("", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := session.match((*r).(Disallow).Pattern, "main.c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s with %#v matching main.c = %t, want %t", rule, tt.value, got, tt.want)
+		}
+	}
+}
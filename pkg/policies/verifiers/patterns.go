@@ -0,0 +1,136 @@
+package verifiers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pattern is the artifact name pattern of an artifact rule: a glob by
+// default, or a regular expression when prefixed with REGEX. Both have to
+// match the whole name.
+type Pattern struct {
+	Regex bool   `parser:"@\"REGEX\"?"`
+	Value string `parser:"@String"`
+}
+
+func (p Pattern) String() string {
+	if p.Regex {
+		return "REGEX " + strconv.Quote(p.Value)
+	}
+	return p.Value
+}
+
+// EscapeGlob returns a glob that only matches the name itself.
+func EscapeGlob(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// literal reports whether the pattern only matches the name equal to it.
+func (p Pattern) literal() bool {
+	return !p.Regex && !strings.ContainsAny(p.Value, `*?[\`)
+}
+
+// rejectsAll reports whether the pattern is a bare "*", which DISALLOW reads
+// as "**".
+func (p Pattern) rejectsAll() bool {
+	return !p.Regex && p.Value == "*"
+}
+
+func (p Pattern) compile() (*regexp.Regexp, error) {
+	expr := p.Value
+	if !p.Regex {
+		var err error
+		if expr, err = globToRegexp(p.Value); err != nil {
+			return nil, err
+		}
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+	}
+	return re, nil
+}
+
+// match reports whether the pattern matches name. Patterns are compiled once
+// per session, which only ever holds those of the policy it verifies.
+func (s *Session) match(p Pattern, name string) (bool, error) {
+	if p.literal() {
+		return p.Value == name, nil
+	}
+	s.mu.RLock()
+	re, ok := s.patterns[p]
+	s.mu.RUnlock()
+	if !ok {
+		var err error
+		if re, err = p.compile(); err != nil {
+			return false, err
+		}
+		s.mu.Lock()
+		s.patterns[p] = re
+		s.mu.Unlock()
+	}
+	return re.MatchString(name), nil
+}
+
+// globToRegexp translates a glob into a regular expression. * and ? do not
+// match path separators, ** matches across them and [...] is a character
+// class that ! or ^ negates. A backslash escapes the next character.
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// **/ also matches no directory at all.
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == 0 {
+				// A leading ] is part of the class.
+				if next := strings.IndexByte(glob[i+2:], ']'); next >= 0 {
+					end = next + 1
+				} else {
+					end = -1
+				}
+			}
+			if end < 0 {
+				return "", fmt.Errorf("invalid pattern %s: unterminated character class", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("invalid pattern %s: trailing backslash", glob)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,162 @@
+package verifiers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern Pattern
+		name    string
+		want    bool
+	}{
+		{Pattern{Value: "main.c"}, "main.c", true},
+		{Pattern{Value: "main.c"}, "src/main.c", false},
+		{Pattern{Value: "*"}, "main.c", true},
+		{Pattern{Value: "*"}, "src/main.c", false},
+		{Pattern{Value: "*.c"}, "main.c", true},
+		{Pattern{Value: "*.c"}, "main.o", false},
+		{Pattern{Value: "**"}, "main.c", true},
+		{Pattern{Value: "**"}, "src/evil.c", true},
+		{Pattern{Value: "**/*.c"}, "main.c", true},
+		{Pattern{Value: "**/*.c"}, "src/lib/evil.c", true},
+		{Pattern{Value: "src/**"}, "src/lib/evil.c", true},
+		{Pattern{Value: "src/**"}, "lib/evil.c", false},
+		{Pattern{Value: "?.c"}, "a.c", true},
+		{Pattern{Value: "?.c"}, "/.c", false},
+		{Pattern{Value: "[ab].c"}, "b.c", true},
+		{Pattern{Value: "[!ab].c"}, "b.c", false},
+		{Pattern{Value: "[!ab].c"}, "c.c", true},
+		{Pattern{Value: `\*.c`}, "*.c", true},
+		{Pattern{Value: `\*.c`}, "main.c", false},
+		{Pattern{Value: "main.c"}, "mainxc", false},
+		{Pattern{Regex: true, Value: `.*\.c`}, "src/evil.c", true},
+		{Pattern{Regex: true, Value: `main`}, "main.c", false},
+	}
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, err := session.match(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.pattern, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s matching %s = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatternInvalid(t *testing.T) {
+	for _, p := range []Pattern{
+		{Value: "[abc"},
+		{Value: `trailing\`},
+		{Regex: true, Value: "("},
+	} {
+		if _, err := p.compile(); err == nil {
+			t.Errorf("%s: expected an error", p)
+		}
+	}
+}
+
+func TestPatternsCachedPerSession(t *testing.T) {
+	first, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.match(Pattern{Value: "*.c"}, "main.c"); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.patterns) != 1 {
+		t.Errorf("first session cached %d patterns, want 1", len(first.patterns))
+	}
+	if len(second.patterns) != 0 {
+		t.Errorf("second session cached %d patterns, want none", len(second.patterns))
+	}
+}
+
+func TestDisallowNestedArtifacts(t *testing.T) {
+	statement := &ita.Statement{
+		Type: ita.StatementTypeUri,
+		Subject: []*ita.ResourceDescriptor{
+			{Name: "main.c", Digest: map[string]string{"sha256": strings.Repeat("a", 64)}},
+			{Name: "src/evil.c", Digest: map[string]string{"sha256": strings.Repeat("b", 64)}},
+		},
+		PredicateType: "https://example.com/predicate",
+	}
+	tests := []struct {
+		disallow string
+		wantErr  string
+	}{
+		{`DISALLOW "**"`, "matched with a disallowed resource pattern '**': src/evil.c"},
+		{`DISALLOW "src/**"`, "matched with a disallowed resource pattern 'src/**': src/evil.c"},
+		{`DISALLOW "**/*.c"`, "matched with a disallowed resource pattern '**/*.c': src/evil.c"},
+		// A bare * keeps rejecting nested artifacts, unlike * elsewhere.
+		{`DISALLOW "*"`, "matched with a disallowed resource pattern '*': src/evil.c"},
+		{`DISALLOW "*.c"`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.disallow, func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar := &models.ArtifactRules{
+				Field: "this.subject",
+				Rules: []string{`ALLOW "main.c"`, tt.disallow},
+			}
+			err = verifyArtifactRules(session, statement, ar, "build")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("expected error %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLintBareDisallow(t *testing.T) {
+	policy := &models.Policy{
+		Type: ArtifactRulesPolicyType,
+		Definition: map[string]any{
+			"field": "this.subject",
+			"rules": []any{`ALLOW "main.c"`, `DISALLOW "*"`, `DISALLOW "**"`},
+		},
+	}
+	issues := LintPolicy(policy, "build", "https://example.com/predicate", &LintScope{})
+	if len(issues) != 1 {
+		t.Fatalf("expected one issue, got: %v", issues)
+	}
+	if issues[0].Index != 1 || !strings.Contains(issues[0].Err.Error(), `write DISALLOW "**" instead`) {
+		t.Errorf("unexpected issue: %+v", issues[0])
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.c", "a*b", "what?.c", "[abc].o", `dir\file`, "**"} {
+		p := Pattern{Value: EscapeGlob(name)}
+		if ok, err := session.match(p, name); err != nil || !ok {
+			t.Errorf("%s does not match %s: %v", p, name, err)
+		}
+		for _, other := range []string{"axb", "whatx.c", "a.o", "dir/file", "src/main.c"} {
+			if ok, _ := session.match(p, other); ok && other != name {
+				t.Errorf("%s matches %s", p, other)
+			}
+		}
+	}
+}
@@ -10,29 +10,31 @@ import (
 	ita "github.com/in-toto/attestation/go/v1"
 )
 
-var (
-	statements map[string]any = make(map[string]any)
-)
-
-func verifyPredicateAttribute(s *ita.Statement, pa *models.PredicateAttribute, rule_name string) (err error) {
-	if err = initializeCelEnv(); err != nil {
-		return
+func verifyPredicateAttribute(session *Session, s *ita.Statement, pa *models.PredicateAttribute, rule_name string) error {
+	env, err := session.env().Extend(predicateOptions(s.PredicateType)...)
+	if err != nil {
+		return err
+	}
+	predicate, err := predicateValue(s)
+	if err != nil {
+		return err
 	}
+	vars := session.activation(s)
+	vars["predicate"] = predicate
 
 	for _, e := range pa.Expressions {
-		ast, issues := celEnv.Compile(e)
-		if err = issues.Err(); err != nil {
-			return
+		ast, issues := env.Compile(e)
+		if err := issues.Err(); err != nil {
+			return err
 		}
 		if !reflect.DeepEqual(ast.OutputType(), cel.BoolType) {
 			return errors.New("predicate attribute expression must resolve to a boolean")
 		}
-		program, err := celEnv.Program(ast)
+		program, err := env.Program(ast)
 		if err != nil {
 			return err
 		}
-		statements["this"] = s
-		out, _, err := program.Eval(statements)
+		out, _, err := program.Eval(vars)
 		if err != nil {
 			return err
 		}
@@ -40,8 +42,5 @@ func verifyPredicateAttribute(s *ita.Statement, pa *models.PredicateAttribute, r
 			return errors.New(fmt.Sprintf("predicate attribute rule failed: %s", e))
 		}
 	}
-
-	celEnv.Extend(cel.Variable(rule_name, cel.ObjectType("in_toto_attestation.v1.Statement")))
-	statements[rule_name] = s
 	return nil
 }
@@ -0,0 +1,194 @@
+package verifiers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	lpb "github.com/in-toto/attestation/go/predicates/link/v0"
+	provpb "github.com/in-toto/attestation/go/predicates/provenance/v1"
+	relpb "github.com/in-toto/attestation/go/predicates/release/v0"
+	scaipb "github.com/in-toto/attestation/go/predicates/scai/v0"
+	trpb "github.com/in-toto/attestation/go/predicates/test_result/v0"
+	vsa0pb "github.com/in-toto/attestation/go/predicates/vsa/v0"
+	vsapb "github.com/in-toto/attestation/go/predicates/vsa/v1"
+	ita "github.com/in-toto/attestation/go/v1"
+	"github.com/stoewer/go-strcase"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	predicateTypesMu sync.RWMutex
+	// Predicate types without a message here, such as runtime traces, are
+	// walked as plain JSON.
+	predicateTypes = map[string]func() proto.Message{
+		"https://in-toto.io/attestation/link/v0.3":                  func() proto.Message { return &lpb.Link{} },
+		"https://slsa.dev/provenance/v1":                            func() proto.Message { return &provpb.Provenance{} },
+		"https://in-toto.io/attestation/test-result/v0.1":           func() proto.Message { return &trpb.TestResult{} },
+		"https://slsa.dev/verification_summary/v1":                  func() proto.Message { return &vsapb.VerificationSummary{} },
+		"https://slsa.dev/verification_summary/v0.2":                func() proto.Message { return &vsa0pb.VerificationSummary{} },
+		"https://in-toto.io/attestation/release/v0.1":               func() proto.Message { return &relpb.Release{} },
+		"https://in-toto.io/attestation/scai/attribute-report/v0.2": func() proto.Message { return &scaipb.AttributeReport{} },
+	}
+)
+
+// RegisterPredicateType makes predicates of the given type decode into the
+// message returned by newMessage, so that their fields can be used by
+// artifact rules.
+func RegisterPredicateType(predicateType string, newMessage func() proto.Message) {
+	predicateTypesMu.Lock()
+	defer predicateTypesMu.Unlock()
+	predicateTypes[predicateType] = newMessage
+}
+
+func lookupPredicateType(predicateType string) (func() proto.Message, bool) {
+	predicateTypesMu.RLock()
+	defer predicateTypesMu.RUnlock()
+	newMessage, ok := predicateTypes[predicateType]
+	return newMessage, ok
+}
+
+// decodePredicate decodes the predicate of a statement into its registered
+// message, or returns nil for an unregistered predicate type.
+func decodePredicate(s *ita.Statement) (proto.Message, error) {
+	newMessage, ok := lookupPredicateType(s.PredicateType)
+	if !ok {
+		return nil, nil
+	}
+	data, err := protojson.Marshal(s.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	m := newMessage()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode predicate of type %s: %w", s.PredicateType, err)
+	}
+	return m, nil
+}
+
+var resourceDescriptorName = (&ita.ResourceDescriptor{}).ProtoReflect().Descriptor().FullName()
+
+// getArtifactResourceDescriptors resolves a field such as this.subject or
+// this.predicate.buildDefinition.resolvedDependencies to the resource
+// descriptors it holds, keyed by name.
+func getArtifactResourceDescriptors(s *ita.Statement, field string) (map[string]*ita.ResourceDescriptor, error) {
+	path := strings.Split(strings.TrimPrefix(field, "this."), ".")
+
+	var rds []*ita.ResourceDescriptor
+	var err error
+	if path[0] == "predicate" {
+		predicate, derr := decodePredicate(s)
+		switch {
+		case derr != nil:
+			return nil, derr
+		case predicate == nil:
+			rds, err = structResourceDescriptors(structpb.NewStructValue(s.Predicate), path[1:])
+		default:
+			rds, err = messageResourceDescriptors(predicate.ProtoReflect(), path[1:])
+		}
+	} else {
+		rds, err = messageResourceDescriptors(s.ProtoReflect(), path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, field)
+	}
+
+	rds_map := make(map[string]*ita.ResourceDescriptor)
+	for _, rd := range rds {
+		rds_map[rd.Name] = rd
+	}
+	return rds_map, nil
+}
+
+func messageResourceDescriptors(m protoreflect.Message, path []string) ([]*ita.ResourceDescriptor, error) {
+	for i, name := range path {
+		fd := findField(m.Descriptor(), name)
+		if fd == nil {
+			return nil, errors.New("statement field does not exist")
+		}
+		if i < len(path)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, errors.New("statement field is not a message")
+			}
+			if fd.Message().FullName() == "google.protobuf.Struct" {
+				st, _ := m.Get(fd).Message().Interface().(*structpb.Struct)
+				return structResourceDescriptors(structpb.NewStructValue(st), path[i+1:])
+			}
+			m = m.Get(fd).Message()
+			continue
+		}
+
+		if !fd.IsList() || fd.Message() == nil || fd.Message().FullName() != resourceDescriptorName {
+			return nil, errors.New("statement field is not a collection of resource descriptor")
+		}
+		list := m.Get(fd).List()
+		rds := make([]*ita.ResourceDescriptor, list.Len())
+		for j := range rds {
+			rds[j] = list.Get(j).Message().Interface().(*ita.ResourceDescriptor)
+		}
+		return rds, nil
+	}
+	return nil, errors.New("statement field is not a collection of resource descriptor")
+}
+
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByJSONName(strcase.LowerCamelCase(name)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByName(protoreflect.Name(strcase.SnakeCase(name)))
+}
+
+// structResourceDescriptors follows path through arbitrary JSON and decodes
+// the list found there as resource descriptors.
+func structResourceDescriptors(v *structpb.Value, path []string) ([]*ita.ResourceDescriptor, error) {
+	for _, name := range path {
+		fields := v.GetStructValue().GetFields()
+		next, ok := fields[name]
+		if !ok {
+			next, ok = fields[strcase.SnakeCase(name)]
+		}
+		if !ok {
+			return nil, errors.New("statement field does not exist")
+		}
+		v = next
+	}
+
+	list := v.GetListValue()
+	if list == nil {
+		return nil, errors.New("statement field is not a collection of resource descriptor")
+	}
+	rds := make([]*ita.ResourceDescriptor, 0, len(list.Values))
+	for _, item := range list.Values {
+		if item.GetStructValue() == nil {
+			return nil, errors.New("statement field is not a collection of resource descriptor")
+		}
+		data, err := protojson.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		rd := &ita.ResourceDescriptor{}
+		if err := protojson.Unmarshal(data, rd); err != nil {
+			return nil, errors.New("statement field is not a collection of resource descriptor")
+		}
+		rds = append(rds, rd)
+	}
+	return rds, nil
+}
+
+// ResourceDescriptors returns the resource descriptors held by a field of
+// the statement, as used by artifact rules.
+func ResourceDescriptors(s *ita.Statement, field string) ([]*ita.ResourceDescriptor, error) {
+	rds, err := getArtifactResourceDescriptors(s, field)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ita.ResourceDescriptor, 0, len(rds))
+	for _, name := range sortedNames(rds) {
+		list = append(list, rds[name])
+	}
+	return list, nil
+}
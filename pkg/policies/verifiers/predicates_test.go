@@ -0,0 +1,194 @@
+package verifiers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	lpb "github.com/in-toto/attestation/go/predicates/link/v0"
+	ita "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	linkPredicateType   = "https://in-toto.io/attestation/link/v0.3"
+	customPredicateType = "https://example.com/custom/v1"
+)
+
+func testStatement(t *testing.T, predicateType string, predicate map[string]any) *ita.Statement {
+	t.Helper()
+	st, err := structpb.NewStruct(predicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ita.Statement{
+		Type:          ita.StatementTypeUri,
+		Subject:       []*ita.ResourceDescriptor{{Name: "app", Digest: map[string]string{"sha256": strings.Repeat("a", 64)}}},
+		PredicateType: predicateType,
+		Predicate:     st,
+	}
+}
+
+// registerTestPredicateType registers a predicate type for the duration of
+// the test.
+func registerTestPredicateType(t *testing.T, predicateType string, newMessage func() proto.Message) {
+	RegisterPredicateType(predicateType, newMessage)
+	t.Cleanup(func() {
+		predicateTypesMu.Lock()
+		defer predicateTypesMu.Unlock()
+		delete(predicateTypes, predicateType)
+	})
+}
+
+func TestGetArtifactResourceDescriptors(t *testing.T) {
+	link := map[string]any{
+		"name":      "build",
+		"command":   []any{"make"},
+		"materials": []any{map[string]any{"name": "main.c"}, map[string]any{"name": "Makefile"}},
+	}
+	tests := []struct {
+		name          string
+		predicateType string
+		predicate     map[string]any
+		register      bool
+		field         string
+		want          []string
+		wantErr       string
+	}{
+		{
+			name:  "statement subject",
+			field: "this.subject", predicateType: linkPredicateType, predicate: link,
+			want: []string{"app"},
+		},
+		{
+			name:  "registered predicate",
+			field: "this.predicate.materials", predicateType: linkPredicateType, predicate: link,
+			want: []string{"Makefile", "main.c"},
+		},
+		{
+			name:  "registered predicate without the field",
+			field: "this.predicate.inputs", predicateType: linkPredicateType, predicate: link,
+			wantErr: "statement field does not exist: this.predicate.inputs",
+		},
+		{
+			name:  "registered predicate with a field that is not a list of resource descriptors",
+			field: "this.predicate.command", predicateType: linkPredicateType, predicate: link,
+			wantErr: "this.predicate.command",
+		},
+		{
+			name:  "registered predicate that does not decode",
+			field: "this.predicate.materials", predicateType: linkPredicateType,
+			predicate: map[string]any{"materials": "main.c"},
+			wantErr:   "failed to decode predicate of type " + linkPredicateType,
+		},
+		{
+			name:  "unregistered predicate is walked as JSON",
+			field: "this.predicate.inputs", predicateType: customPredicateType,
+			predicate: map[string]any{"inputs": []any{map[string]any{"name": "config.yaml"}}},
+			want:      []string{"config.yaml"},
+		},
+		{
+			name:  "registered custom predicate",
+			field: "this.predicate.materials", predicateType: customPredicateType, predicate: link,
+			register: true,
+			want:     []string{"Makefile", "main.c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.register {
+				registerTestPredicateType(t, tt.predicateType, func() proto.Message { return &lpb.Link{} })
+			}
+			rds, err := getArtifactResourceDescriptors(testStatement(t, tt.predicateType, tt.predicate), tt.field)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedNames(rds); !slices.Equal(got, tt.want) {
+				t.Errorf("artifacts are %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredicateAttributeTypedPredicate(t *testing.T) {
+	link := map[string]any{"name": "build", "command": []any{"make", "all"}}
+	tests := []struct {
+		name          string
+		predicateType string
+		predicate     map[string]any
+		register      bool
+		expression    string
+		wantErr       string
+	}{
+		{
+			name:          "field of a registered predicate",
+			predicateType: linkPredicateType, predicate: link,
+			expression: `predicate.command == ["make", "all"] && predicate.name == "build" && this.subject[0].name == "app"`,
+		},
+		{
+			name:          "unknown field of a registered predicate fails to compile",
+			predicateType: linkPredicateType, predicate: link,
+			expression: `predicate.comand == ["make", "all"]`,
+			wantErr:    "undefined field 'comand'",
+		},
+		{
+			name:          "mistyped field of a registered predicate fails to compile",
+			predicateType: linkPredicateType, predicate: link,
+			expression: `predicate.name == 1`,
+			wantErr:    "no matching overload",
+		},
+		{
+			name:          "failing expression",
+			predicateType: linkPredicateType, predicate: link,
+			expression: `predicate.command.size() == 1`,
+			wantErr:    "predicate attribute rule failed: predicate.command.size() == 1",
+		},
+		{
+			name:          "unregistered predicate is dynamic",
+			predicateType: customPredicateType,
+			predicate:     map[string]any{"comand": "make", "retries": 2},
+			expression:    `predicate.comand == "make" && predicate.retries == 2.0`,
+		},
+		{
+			name:          "missing key of an unregistered predicate fails at evaluation",
+			predicateType: customPredicateType,
+			predicate:     map[string]any{"comand": "make"},
+			expression:    `predicate.command == "make"`,
+			wantErr:       "no such key: command",
+		},
+		{
+			name:          "registered custom predicate is typed",
+			predicateType: customPredicateType, predicate: link,
+			register:   true,
+			expression: `predicate.comand == ["make", "all"]`,
+			wantErr:    "undefined field 'comand'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.register {
+				registerTestPredicateType(t, tt.predicateType, func() proto.Message { return &lpb.Link{} })
+			}
+			session, err := NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pa := &models.PredicateAttribute{Expressions: []string{tt.expression}}
+			err = verifyPredicateAttribute(session, testStatement(t, tt.predicateType, tt.predicate), pa, "build")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package verifiers
+
+import (
+	"strings"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/google/cel-go/common/ast"
+)
+
+// PolicyReferences returns every name a policy may use to refer to another
+// attestation rule: the targets of MATCH and MISMATCH rules, the before and
+// after fields of artifact rules and the identifiers used in CEL
+// expressions. Qualified names are returned along with all of their
+// prefixes, so callers can look up whichever prefix is a known rule name.
+func PolicyReferences(policy *models.Policy) ([]string, error) {
+	var names []string
+	switch policy.Type {
+	case ArtifactRulesPolicyType:
+		var ar models.ArtifactRules
+		if err := decodeDefinition(policy, &ar); err != nil {
+			return nil, err
+		}
+		for _, f := range []string{ar.Before, ar.After} {
+			if f != "" && !strings.HasPrefix(f, "this.") {
+				names = append(names, qualifiedPrefixes(f)...)
+			}
+		}
+		for _, r := range ar.Rules {
+			rule, err := arParser.ParseString("", r)
+			if err != nil {
+				return nil, err
+			}
+			switch r := (*rule).(type) {
+			case Match:
+				names = append(names, qualifiedPrefixes(r.Field)...)
+			case Mismatch:
+				names = append(names, qualifiedPrefixes(r.Field)...)
+			}
+		}
+	case PredicateAttributePolicyType:
+		var pa models.PredicateAttribute
+		if err := decodeDefinition(policy, &pa); err != nil {
+			return nil, err
+		}
+		env, err := newCelEnv()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range pa.Expressions {
+			parsed, issues := env.Parse(e)
+			if err := issues.Err(); err != nil {
+				return nil, err
+			}
+			for _, n := range celIdentifiers(parsed.NativeRep().Expr()) {
+				names = append(names, qualifiedPrefixes(n)...)
+			}
+		}
+	}
+	return names, nil
+}
+
+func celIdentifiers(expr ast.Expr) []string {
+	var names []string
+	ast.PreOrderVisit(expr, ast.NewExprVisitor(func(e ast.Expr) {
+		if name, ok := qualifiedName(e); ok {
+			names = append(names, name)
+		}
+	}))
+	return names
+}
+
+func qualifiedName(e ast.Expr) (string, bool) {
+	switch e.Kind() {
+	case ast.IdentKind:
+		return e.AsIdent(), true
+	case ast.SelectKind:
+		sel := e.AsSelect()
+		if sel.IsTestOnly() {
+			return "", false
+		}
+		operand, ok := qualifiedName(sel.Operand())
+		if !ok {
+			return "", false
+		}
+		return operand + "." + sel.FieldName(), true
+	}
+	return "", false
+}
+
+func qualifiedPrefixes(name string) []string {
+	parts := strings.Split(name, ".")
+	prefixes := make([]string, len(parts))
+	for i := range parts {
+		prefixes[i] = strings.Join(parts[:i+1], ".")
+	}
+	return prefixes
+}
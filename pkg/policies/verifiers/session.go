@@ -0,0 +1,105 @@
+package verifiers
+
+import (
+	"maps"
+	"regexp"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+// Session holds the artifacts and statements recorded while verifying a
+// single policy document, so that later rules can refer to earlier ones
+// without any state leaking into other verifications. A Session is safe for
+// concurrent use by rules that do not depend on each other.
+type Session struct {
+	mu             sync.RWMutex
+	fieldArtifacts map[string]map[string]*ita.ResourceDescriptor
+	statements     map[string]any
+	celEnv         *cel.Env
+	traces         map[string][]ArtifactTrace
+	patterns       map[Pattern]*regexp.Regexp
+}
+
+func NewSession() (*Session, error) {
+	env, err := newCelEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		fieldArtifacts: make(map[string]map[string]*ita.ResourceDescriptor),
+		statements:     make(map[string]any),
+		celEnv:         env,
+		patterns:       make(map[Pattern]*regexp.Regexp),
+	}, nil
+}
+
+func (s *Session) artifacts(field string) (map[string]*ita.ResourceDescriptor, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rds, ok := s.fieldArtifacts[field]
+	return rds, ok
+}
+
+func (s *Session) recordArtifacts(field string, rds map[string]*ita.ResourceDescriptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fieldArtifacts[field] = rds
+}
+
+func (s *Session) env() *cel.Env {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.celEnv
+}
+
+func (s *Session) activation(statement *ita.Statement) map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vars := maps.Clone(s.statements)
+	vars["this"] = statement
+	return vars
+}
+
+// RecordStatement makes the verified statement of an attestation rule
+// available to the expressions of later rules under the rule's name.
+func (s *Session) RecordStatement(rule_name string, statement *ita.Statement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.statements[rule_name]; !ok {
+		env, err := s.celEnv.Extend(cel.Variable(rule_name, cel.ObjectType("in_toto_attestation.v1.Statement")))
+		if err != nil {
+			return err
+		}
+		s.celEnv = env
+	}
+	s.statements[rule_name] = statement
+	return nil
+}
+
+// Import makes a verified sub-policy available under its namespace: the
+// statements of its attestation rules as e.g. frontend.build, the artifact
+// fields its session recorded as e.g. frontend.build.subject, and its final
+// subjects as frontend.subject.
+func (s *Session) Import(namespace string, sub *Session, statements map[string]*ita.Statement, subjects []*ita.ResourceDescriptor) error {
+	for name, statement := range statements {
+		if err := s.RecordStatement(namespace+"."+name, statement); err != nil {
+			return err
+		}
+	}
+
+	sub.mu.RLock()
+	fields := maps.Clone(sub.fieldArtifacts)
+	sub.mu.RUnlock()
+	for field, rds := range fields {
+		s.recordArtifacts(namespace+"."+field, rds)
+	}
+
+	rds := make(map[string]*ita.ResourceDescriptor, len(subjects))
+	for _, rd := range subjects {
+		rds[rd.GetName()] = rd
+	}
+	s.recordArtifacts(namespace+".subject", rds)
+	return nil
+}
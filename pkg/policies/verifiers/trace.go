@@ -0,0 +1,96 @@
+package verifiers
+
+import ita "github.com/in-toto/attestation/go/v1"
+
+// ArtifactOutcome is what an artifact rule did with a queued artifact.
+type ArtifactOutcome string
+
+const (
+	ArtifactConsumed ArtifactOutcome = "CONSUMED"
+	// ArtifactKept marks an artifact a rule applied to but did not consume,
+	// e.g. because a MATCH found a different digest.
+	ArtifactKept     ArtifactOutcome = "KEPT"
+	ArtifactRejected ArtifactOutcome = "REJECTED"
+	// ArtifactRemaining marks an artifact left in the queue after all rules.
+	ArtifactRemaining ArtifactOutcome = "REMAINING"
+)
+
+// ArtifactTrace records one artifact rule applying to one queued artifact.
+type ArtifactTrace struct {
+	Field    string          `json:"field"`
+	Artifact string          `json:"artifact"`
+	Rule     string          `json:"rule,omitempty"`
+	Outcome  ArtifactOutcome `json:"outcome"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// EnableTrace makes the session record how artifact rules treat every
+// queued artifact, which is retrieved with ArtifactTraces.
+func (s *Session) EnableTrace() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = make(map[string][]ArtifactTrace)
+}
+
+// ArtifactTraces returns the traces recorded while verifying the artifact
+// rules of an attestation rule.
+func (s *Session) ArtifactTraces(rule_name string) []ArtifactTrace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.traces[rule_name]
+}
+
+// tracer collects the traces of a single artifact rules policy. A nil tracer
+// records nothing.
+type tracer struct {
+	field  string
+	rule   string
+	traces []ArtifactTrace
+}
+
+func (s *Session) tracer(field string) *tracer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.traces == nil {
+		return nil
+	}
+	return &tracer{field: field}
+}
+
+func (t *tracer) setRule(rule string) {
+	if t != nil {
+		t.rule = rule
+	}
+}
+
+func (t *tracer) record(artifact string, outcome ArtifactOutcome, reason string) {
+	if t == nil {
+		return
+	}
+	t.traces = append(t.traces, ArtifactTrace{
+		Field:    t.field,
+		Artifact: artifact,
+		Rule:     t.rule,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+}
+
+func (t *tracer) remaining(rds map[string]*ita.ResourceDescriptor) {
+	if t == nil {
+		return
+	}
+	t.rule = ""
+	for _, name := range sortedNames(rds) {
+		t.record(name, ArtifactRemaining, "not consumed by any rule")
+	}
+}
+
+func (s *Session) recordTraces(rule_name string, t *tracer) {
+	if t == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces[rule_name] = append(s.traces[rule_name], t.traces...)
+}
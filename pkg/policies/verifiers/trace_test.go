@@ -0,0 +1,109 @@
+package verifiers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	ita "github.com/in-toto/attestation/go/v1"
+)
+
+func TestArtifactTraces(t *testing.T) {
+	sha256a := map[string]string{"sha256": strings.Repeat("a", 64)}
+	sha256b := map[string]string{"sha256": strings.Repeat("b", 64)}
+	statement := &ita.Statement{
+		Type: ita.StatementTypeUri,
+		Subject: []*ita.ResourceDescriptor{
+			{Name: "README", Digest: sha256a},
+			{Name: "app", Digest: sha256a},
+			{Name: "lib", Digest: sha256a},
+			{Name: "tool", Digest: sha256a},
+		},
+		PredicateType: "https://example.com/predicate",
+	}
+	build := map[string]*ita.ResourceDescriptor{
+		"app": {Name: "app", Digest: sha256a},
+		"lib": {Name: "lib", Digest: sha256b},
+	}
+
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr string
+		want    []ArtifactTrace
+	}{
+		{
+			name:  "passing rules",
+			rules: []string{`MATCH "*" WITH "build.subject"`, `ALLOW "README"`},
+			want: []ArtifactTrace{
+				{Artifact: "README", Rule: `MATCH "*" WITH "build.subject"`, Outcome: ArtifactKept, Reason: "destination missing: README in build.subject"},
+				{Artifact: "app", Rule: `MATCH "*" WITH "build.subject"`, Outcome: ArtifactConsumed},
+				{Artifact: "lib", Rule: `MATCH "*" WITH "build.subject"`, Outcome: ArtifactKept, Reason: "sha256 digest differs"},
+				{Artifact: "tool", Rule: `MATCH "*" WITH "build.subject"`, Outcome: ArtifactKept, Reason: "destination missing: tool in build.subject"},
+				{Artifact: "README", Rule: `ALLOW "README"`, Outcome: ArtifactConsumed},
+				{Artifact: "lib", Outcome: ArtifactRemaining, Reason: "not consumed by any rule"},
+				{Artifact: "tool", Outcome: ArtifactRemaining, Reason: "not consumed by any rule"},
+			},
+		},
+		{
+			name:    "failing rules",
+			rules:   []string{`MATCH "app" WITH "build.subject"`, `ALLOW "README"`, `DISALLOW "**"`},
+			wantErr: "disallowed resource pattern '**': lib",
+			// Verification stops at the first rejected artifact, so tool is
+			// neither rejected nor remaining.
+			want: []ArtifactTrace{
+				{Artifact: "app", Rule: `MATCH "app" WITH "build.subject"`, Outcome: ArtifactConsumed},
+				{Artifact: "README", Rule: `ALLOW "README"`, Outcome: ArtifactConsumed},
+				{Artifact: "lib", Rule: `DISALLOW "**"`, Outcome: ArtifactRejected, Reason: "matched with a disallowed resource pattern '**': lib"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.EnableTrace()
+			session.recordArtifacts("build.subject", build)
+			ar := &models.ArtifactRules{Field: "this.subject", Rules: tt.rules}
+			err = verifyArtifactRules(session, statement, ar, "package")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+
+			for i := range tt.want {
+				tt.want[i].Field = "this.subject"
+			}
+			if got := session.ArtifactTraces("package"); !slices.Equal(got, tt.want) {
+				t.Errorf("traces are\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if got := session.ArtifactTraces("build"); got != nil {
+				t.Errorf("unexpected traces for another rule: %+v", got)
+			}
+		})
+	}
+}
+
+func TestArtifactTracesDisabled(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := &ita.Statement{
+		Type:          ita.StatementTypeUri,
+		Subject:       []*ita.ResourceDescriptor{{Name: "app"}},
+		PredicateType: "https://example.com/predicate",
+	}
+	ar := &models.ArtifactRules{Field: "this.subject", Rules: []string{`ALLOW "app"`}}
+	if err := verifyArtifactRules(session, statement, ar, "package"); err != nil {
+		t.Fatal(err)
+	}
+	if got := session.ArtifactTraces("package"); got != nil {
+		t.Errorf("traces recorded without EnableTrace: %+v", got)
+	}
+}
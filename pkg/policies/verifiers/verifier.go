@@ -8,27 +8,34 @@ import (
 	ita "github.com/in-toto/attestation/go/v1"
 )
 
-func VerifyPolicy(statement *ita.Statement, policy *models.Policy, rule_name string) error {
-	m, err := json.Marshal(policy.Definition)
-	if err != nil {
-		return err
-	}
+const (
+	ArtifactRulesPolicyType      = "https://in-toto.io/policy/artifact-rules/v0.1"
+	PredicateAttributePolicyType = "https://in-toto.io/policy/predicate-attribute/v0.1"
+)
+
+func VerifyPolicy(session *Session, statement *ita.Statement, policy *models.Policy, rule_name string) error {
 	switch policy.Type {
-	case "https://in-toto.io/policy/artifact-rules/v0.1":
+	case ArtifactRulesPolicyType:
 		var ar models.ArtifactRules
-		err = json.Unmarshal(m, &ar)
-		if err != nil {
+		if err := decodeDefinition(policy, &ar); err != nil {
 			return err
 		}
-		return verifyArtifactRules(statement, &ar, rule_name)
-	case "https://in-toto.io/policy/predicate-attribute/v0.1":
+		return verifyArtifactRules(session, statement, &ar, rule_name)
+	case PredicateAttributePolicyType:
 		var pa models.PredicateAttribute
-		err = json.Unmarshal(m, &pa)
-		if err != nil {
+		if err := decodeDefinition(policy, &pa); err != nil {
 			return err
 		}
-		return verifyPredicateAttribute(statement, &pa, rule_name)
+		return verifyPredicateAttribute(session, statement, &pa, rule_name)
 	default:
 		return errors.New("unsupported policy type")
 	}
 }
+
+func decodeDefinition(policy *models.Policy, v any) error {
+	m, err := json.Marshal(policy.Definition)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(m, v)
+}
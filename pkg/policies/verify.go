@@ -2,13 +2,13 @@ package policies
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
 	"github.com/alanssitis/in-toto-policies/pkg/policies/verifiers"
@@ -17,167 +17,405 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
-var sugar *zap.SugaredLogger
-
-func Verify(pd models.PolicyDocument, fdir string, adir string) error {
+func Verify(pd models.PolicyDocument, fdir string, adir string) (*VerificationResult, error) {
 	config := zap.NewDevelopmentConfig()
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	logger, err := config.Build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer logger.Sync()
-	sugar = logger.Sugar()
-	defer func() {
-		sugar = nil
-	}()
-
-	sugar.Infof("start policy verification")
 
-	fdir, err = validateDir(fdir)
-	if err != nil {
-		sugar.Errorw("failed to get current directory",
-			"error", err,
-		)
-		return err
-	}
-	vm, err := parseFunctionaries(pd.Functionaries, fdir)
+	v, err := NewVerifier(
+		WithLogger(logger),
+		WithKeySource(NewDirectoryKeySource(fdir)),
+		WithAttestationSource(NewDirectoryAttestationSource(adir, logger)),
+	)
 	if err != nil {
-		sugar.Errorw("failed to parse functionaries",
-			"error", err,
-		)
-		return err
+		return nil, err
 	}
+	return v.Verify(pd)
+}
 
-	adir, err = validateDir(adir)
-	if err != nil {
-		return err
+func (vn *verification) verifyAttestationRules(g *ruleGraph, subPolicies []*SubPolicyResult) *VerificationResult {
+	vn.sugar.Infof("start verifying attestation rules")
+
+	results := make(map[string]*AttestationRuleResult, len(g.rules))
+	done := make(map[string]chan struct{}, len(g.rules))
+	for _, a := range g.rules {
+		done[a.Name] = make(chan struct{})
 	}
-	dir_entries, err := os.ReadDir(adir)
-	if err != nil {
-		sugar.Errorw("failed to parse functionaries",
-			"error", err,
-		)
-		return err
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, vn.workers)
+	for _, a := range g.rules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[a.Name])
+
+			for _, dep := range g.dependencies[a.Name] {
+				<-done[dep]
+			}
+
+			var failed, skipped, failedSubPolicies []string
+			vn.mu.Lock()
+			for _, dep := range g.dependencies[a.Name] {
+				switch results[dep].Status {
+				case StatusFailed:
+					failed = append(failed, dep)
+				case StatusSkipped:
+					skipped = append(skipped, dep)
+				}
+			}
+			vn.mu.Unlock()
+			for _, sp := range subPolicies {
+				if slices.Contains(g.subPolicies[a.Name], sp.Name) && !sp.Result.Passed() {
+					failedSubPolicies = append(failedSubPolicies, sp.Name)
+				}
+			}
+
+			var ar *AttestationRuleResult
+			switch {
+			case len(failed) > 0:
+				ar = (&AttestationRuleResult{Name: a.Name}).fail(
+					fmt.Errorf("depends on failed attestation rules: %s", strings.Join(failed, ", ")),
+				)
+			case len(skipped) > 0:
+				// A skipped rule leaves nothing to MATCH against or refer to,
+				// so rules depending on it fail rather than pass unchecked.
+				ar = (&AttestationRuleResult{Name: a.Name}).fail(
+					fmt.Errorf("depends on skipped attestation rules: %s", strings.Join(skipped, ", ")),
+				)
+			case len(failedSubPolicies) > 0:
+				ar = (&AttestationRuleResult{Name: a.Name}).fail(
+					fmt.Errorf("depends on failed sub-policies: %s", strings.Join(failedSubPolicies, ", ")),
+				)
+			case vn.ctx.Err() != nil:
+				ar = (&AttestationRuleResult{Name: a.Name}).fail(vn.ctx.Err())
+			default:
+				sem <- struct{}{}
+				ar = vn.verifyAttestationRule(a)
+				<-sem
+			}
+			if ar.Status == StatusFailed {
+				vn.sugar.Errorw("failed to verify attestation rule",
+					"name", ar.Name,
+					"status", ar.Status,
+					"reasons", ar.Reasons,
+				)
+			}
+
+			vn.mu.Lock()
+			results[a.Name] = ar
+			vn.mu.Unlock()
+		}()
 	}
+	wg.Wait()
 
-	attestations := mapAttestations(adir, dir_entries)
-	err = verifyAttestationRules(pd.AttestationRules, attestations, vm)
-	if err != nil {
-		sugar.Errorw("failed to verify attestation rule",
-			"error", err,
-		)
+	result := &VerificationResult{
+		Status:           StatusPassed,
+		AttestationRules: make([]*AttestationRuleResult, 0, len(g.rules)),
+		SubPolicies:      subPolicies,
+		session:          vn.session,
 	}
-	return nil
+	for _, a := range g.rules {
+		ar := results[a.Name]
+		if ar.Status == StatusFailed {
+			result.Status = StatusFailed
+		}
+		result.AttestationRules = append(result.AttestationRules, ar)
+	}
+	for _, sp := range subPolicies {
+		if !sp.Result.Passed() {
+			result.Status = StatusFailed
+		}
+	}
+	result.subjects = finalSubjects(g, results, subPolicies)
+	return result
 }
 
-func verifyAttestationRules(attestation_rules []*models.AttestationRule, attestations map[string]string, vm map[string]dsse.Verifier) error {
-	sugar.Infof("start verifying attestation rules")
+// finalSubjects collects the subjects of the verified attestations of rules,
+// and the final subjects of sub-policies, no other rule depends on.
+func finalSubjects(g *ruleGraph, results map[string]*AttestationRuleResult, subPolicies []*SubPolicyResult) []*ita.ResourceDescriptor {
+	dependedOn := make(map[string]bool)
+	for _, deps := range g.dependencies {
+		for _, d := range deps {
+			dependedOn[d] = true
+		}
+	}
+	for _, sps := range g.subPolicies {
+		for _, sp := range sps {
+			dependedOn[sp] = true
+		}
+	}
 
-	for _, a := range attestation_rules {
-		err := verifyAttestationRule(a, attestations, vm)
-		if err != nil {
-			return err
+	var subjects []*ita.ResourceDescriptor
+	add := func(rds []*ita.ResourceDescriptor) {
+		for _, s := range rds {
+			if !slices.ContainsFunc(subjects, func(o *ita.ResourceDescriptor) bool { return proto.Equal(o, s) }) {
+				subjects = append(subjects, s)
+			}
 		}
 	}
-	return nil
+	for _, a := range g.rules {
+		ar := results[a.Name]
+		if dependedOn[a.Name] || ar.statement == nil {
+			continue
+		}
+		add(ar.statement.Subject)
+	}
+	for _, sp := range subPolicies {
+		if !dependedOn[sp.Name] {
+			add(sp.Result.subjects)
+		}
+	}
+	return subjects
 }
 
-func verifyAttestationRule(ar *models.AttestationRule, attestations map[string]string, vm map[string]dsse.Verifier) error {
-	sugar.Infow("start verifying attestation rule",
+func (vn *verification) verifyAttestationRule(ar *models.AttestationRule) *AttestationRuleResult {
+	vn.sugar.Infow("start verifying attestation rule",
 		"name", ar.Name,
 	)
 
-	file := attestations[ar.Name]
-	envelope, err := getEnvelope(file)
-	if err != nil {
-		return fmt.Errorf("failed to get and parse envelope from attestation file: %w", err)
-	}
-	if envelope.PayloadType != "application/vnd.in-toto+json" {
-		return fmt.Errorf("matched with an envelope that is not of type in-toto")
+	result := &AttestationRuleResult{
+		Name:   ar.Name,
+		Status: StatusPassed,
 	}
 
-	ev, err := buildEnvelopeVerifier(ar.AllowedFunctionaries, vm)
+	attestations, err := vn.findAttestations(ar)
 	if err != nil {
-		return fmt.Errorf("failed to build envelope verifier from functionaries: %w", err)
+		return result.fail(err)
 	}
-
-	_, err = ev.Verify(context.TODO(), envelope)
-	if err != nil {
-		return fmt.Errorf("failed to verify attestation from functionaries: %w", err)
+	if len(attestations) == 0 {
+		vn.sugar.Infow("skipping attestation rule without matching attestation",
+			"name", ar.Name,
+		)
+		result.Status = StatusSkipped
+		result.Reasons = append(result.Reasons, "no attestation matched and onNone is skip")
+		return result
+	}
+	for _, a := range attestations {
+		result.AttestationFiles = append(result.AttestationFiles, a.Name)
 	}
 
-	statement, err := getStatement(envelope)
+	statement, signed, err := vn.verifySignatures(ar, attestations, result)
 	if err != nil {
-		return fmt.Errorf("failed to get and parse statement from envelope: %w", err)
+		return result.fail(err)
 	}
-	if ar.PredicateType != statement.PredicateType {
-		return fmt.Errorf("predicate is not of the expected type")
+	result.AttestationFiles = nil
+	for _, a := range signed {
+		result.AttestationFiles = append(result.AttestationFiles, a.Name)
 	}
+	result.attestations = signed
+	if rulePredicateType(ar) != statement.PredicateType {
+		return result.fail(fmt.Errorf("predicate is not of the expected type"))
+	}
+	result.statement = statement
 
-	sugar.Infow("start verifying attestation policies",
+	vn.sugar.Infow("start verifying attestation policies",
 		"name", ar.Name,
 	)
 	for _, p := range ar.Policies {
-		err = verifyPolicy(statement, p, ar.Name)
+		pr := &PolicyResult{
+			Type:   p.Type,
+			Status: StatusPassed,
+		}
+		err = vn.verifyPolicy(statement, p, ar.Name)
 		if err != nil {
-			return fmt.Errorf("policy verification failed: %w", err)
+			pr.Status = StatusFailed
+			pr.Reasons = append(pr.Reasons, err.Error())
+			result.fail(fmt.Errorf("policy verification failed: %w", err))
 		}
+		result.Policies = append(result.Policies, pr)
 	}
+	result.Trace = vn.session.ArtifactTraces(ar.Name)
 
-	sugar.Infow("successfully verified attestation rule",
-		"name", ar.Name,
-		"attestationFileName", file,
-	)
+	if result.Status == StatusPassed {
+		if err := vn.session.RecordStatement(ar.Name, statement); err != nil {
+			return result.fail(err)
+		}
+		vn.sugar.Infow("successfully verified attestation rule",
+			"name", ar.Name,
+			"attestationFileNames", result.AttestationFiles,
+		)
+	}
 
-	return nil
+	return result
+}
+
+// verifySignatures checks that the attestations are signed by at least
+// threshold distinct allowed functionaries, either as several signatures on
+// one envelope or across several envelopes carrying the same statement.
+// Envelopes that do not verify are logged and skipped, so a stray or
+// tampered file cannot fail a rule other envelopes satisfy. It returns the
+// statement along with the attestations that carry it.
+func (vn *verification) verifySignatures(ar *models.AttestationRule, attestations []*Attestation, result *AttestationRuleResult) (*ita.Statement, []*Attestation, error) {
+	threshold := max(ar.Threshold, 1)
+
+	type signedStatement struct {
+		statement     *ita.Statement
+		attestations  []*Attestation
+		signers       map[string]bool
+		keyIDs        []string
+		functionaries []string
+	}
+	var statements []*signedStatement
+	var errs []error
+	for _, a := range attestations {
+		s, accepted, credits, err := vn.verifyEnvelope(ar, a)
+		if err != nil {
+			vn.sugar.Warnw("skipping attestation that failed verification",
+				"name", ar.Name,
+				"file", a.Name,
+				"error", err,
+			)
+			errs = append(errs, fmt.Errorf("%s: %w", a.Name, err))
+			continue
+		}
+
+		i := slices.IndexFunc(statements, func(ss *signedStatement) bool { return proto.Equal(ss.statement, s) })
+		if i < 0 {
+			i = len(statements)
+			statements = append(statements, &signedStatement{statement: s, signers: make(map[string]bool)})
+		}
+		ss := statements[i]
+		ss.attestations = append(ss.attestations, a)
+		for _, k := range accepted {
+			name := credits.functionary(k)
+			if !ss.signers[name] {
+				ss.signers[name] = true
+				ss.keyIDs = append(ss.keyIDs, k.KeyID)
+				ss.functionaries = append(ss.functionaries, name)
+			}
+		}
+	}
+
+	var verified *signedStatement
+	signed := 0
+	for _, ss := range statements {
+		signed = max(signed, len(ss.signers))
+		if len(ss.signers) < threshold {
+			continue
+		}
+		if verified != nil {
+			return nil, nil, errors.New("statements of matched attestations disagree")
+		}
+		verified = ss
+	}
+	if verified == nil {
+		err := fmt.Errorf("failed to verify attestation: signed by %d distinct functionaries, threshold is %d", signed, threshold)
+		if len(errs) > 0 {
+			err = fmt.Errorf("%w: %w", err, joinErrors(errs))
+		}
+		return nil, nil, err
+	}
+
+	result.KeyIDs = verified.keyIDs
+	result.Functionaries = verified.functionaries
+	return verified.statement, verified.attestations, nil
+}
+
+// verifyEnvelope verifies the signatures of allowed functionaries on a single
+// attestation, returning its statement, the accepted keys and the
+// functionaries credited with them.
+func (vn *verification) verifyEnvelope(ar *models.AttestationRule, a *Attestation) (*ita.Statement, []dsse.AcceptedKey, signatureCredits, error) {
+	if a.Envelope.PayloadType != inTotoPayloadType {
+		return nil, nil, nil, errors.New("envelope is not of type in-toto")
+	}
+
+	ev, credits, err := buildEnvelopeVerifier(ar.AllowedFunctionaries, vn.functionaries, a, vn.at)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to build envelope verifier from functionaries: %w", err)
+	}
+	accepted, err := ev.Verify(vn.ctx, a.Envelope)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to verify attestation from functionaries: %w", err)
+	}
+
+	s, err := getStatement(a.Envelope)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get and parse statement from envelope: %w", err)
+	}
+	return s, accepted, credits, nil
 }
 
-func verifyPolicy(statement *ita.Statement, policy *models.Policy, rule_name string) error {
-	sugar.Infow("start verifying policy",
+func (vn *verification) verifyPolicy(statement *ita.Statement, policy *models.Policy, rule_name string) error {
+	vn.sugar.Infow("start verifying policy",
 		"ruleName", rule_name,
 		"policyType", policy.Type,
 	)
-	err := verifiers.VerifyPolicy(statement, policy, rule_name)
+	err := verifiers.VerifyPolicy(vn.session, statement, policy, rule_name)
 	if err != nil {
 		return err
 	}
-	sugar.Infow("successfully verified policy")
+	vn.sugar.Infow("successfully verified policy")
 	return err
 }
 
-func getEnvelope(f string) (*dsse.Envelope, error) {
-	data, err := os.ReadFile(f)
-	if err != nil {
-		return nil, err
+// buildEnvelopeVerifier returns a verifier accepting signatures on the
+// attestation by any of the allowed functionaries, along with the credits
+// naming the functionary whose key accepted each signature.
+func buildEnvelopeVerifier(allowed_functionaries []string, fs map[string]Functionary, a *Attestation, at time.Time) (*dsse.EnvelopeVerifier, signatureCredits, error) {
+	var vs []dsse.Verifier
+	var errs []error
+	credits := make(signatureCredits)
+	for _, f := range allowed_functionaries {
+		fv, ok := fs[f]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown functionary: %s", f)
+		}
+		fvs, err := fv.Verifiers(a, at)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("functionary %s: %w", f, err))
+			continue
+		}
+		for _, v := range fvs {
+			vs = append(vs, &creditingVerifier{Verifier: v, functionary: f, credits: credits})
+		}
+	}
+	if len(vs) == 0 {
+		if len(errs) == 0 {
+			return nil, nil, errors.New("no allowed functionary can verify the attestation")
+		}
+		return nil, nil, fmt.Errorf("no allowed functionary can verify the attestation: %w", joinErrors(errs))
 	}
+	ev, err := dsse.NewEnvelopeVerifier(vs...)
+	return ev, credits, err
+}
+
+// signatureCredits names the functionary that accepted each signature, keyed
+// by the raw signature. Key IDs cannot tell functionaries apart: those of
+// certificate and Sigstore verifiers are taken from the envelope.
+type signatureCredits map[string]string
 
-	var envelope dsse.Envelope
-	err = json.Unmarshal(data, &envelope)
+// functionary returns the name of the functionary that accepted the key.
+func (c signatureCredits) functionary(k dsse.AcceptedKey) string {
+	sig, err := base64.StdEncoding.DecodeString(k.Sig.Sig)
 	if err != nil {
-		return nil, err
+		sig, _ = base64.URLEncoding.DecodeString(k.Sig.Sig)
 	}
-
-	return &envelope, nil
+	return c[string(sig)]
 }
 
-func findMatchingFile(dir_entries []fs.DirEntry, name string, dir string) (string, error) {
-	for _, de := range dir_entries {
-		if strings.HasPrefix(de.Name(), name) && !de.IsDir() {
-			return filepath.Join(dir, de.Name()), nil
-		}
-	}
-	return "", errors.New("could not find matching attestation file")
+// creditingVerifier records the signatures its functionary's key accepts.
+type creditingVerifier struct {
+	dsse.Verifier
+	functionary string
+	credits     signatureCredits
 }
 
-func buildEnvelopeVerifier(allowed_functionaries []string, vm map[string]dsse.Verifier) (*dsse.EnvelopeVerifier, error) {
-	vs := make([]dsse.Verifier, len(allowed_functionaries))
-	for i, f := range allowed_functionaries {
-		vs[i] = vm[f]
+func (v *creditingVerifier) Verify(ctx context.Context, data, sig []byte) error {
+	if err := v.Verifier.Verify(ctx, data, sig); err != nil {
+		return err
 	}
-	return dsse.NewEnvelopeVerifier(vs...)
+	if _, ok := v.credits[string(sig)]; !ok {
+		v.credits[string(sig)] = v.functionary
+	}
+	return nil
 }
 
 func getStatement(envelope *dsse.Envelope) (*ita.Statement, error) {
@@ -193,34 +431,11 @@ func getStatement(envelope *dsse.Envelope) (*ita.Statement, error) {
 	return &statement, nil
 }
 
-func validateDir(dir string) (string, error) {
-	if dir != "" {
-		fi, err := os.Stat(dir)
-		if err != nil {
-			return dir, err
-		}
-		if !fi.IsDir() {
-			return dir, errors.New("path passed is not a directory")
-		}
-		return dir, nil
-	}
-	dir, err := os.Getwd()
-	if err != nil {
-		return dir, err
-	}
-	return dir, nil
-}
-
-func mapAttestations(dir string, dir_entries []fs.DirEntry) map[string]string {
-	ma := make(map[string]string)
-
-	for _, de := range dir_entries {
-		name := de.Name()
-		if ext := filepath.Ext(name); ext != ".json" && ext != ".link" {
-			continue
-		}
-		ma[name[:strings.IndexByte(name, '.')]] = filepath.Join(dir, name)
+// joinErrors is errors.Join, but keeps the message on a single line.
+func joinErrors(errs []error) error {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
 	}
-
-	return ma
+	return errors.New(strings.Join(msgs, "; "))
 }
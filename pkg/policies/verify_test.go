@@ -0,0 +1,159 @@
+package policies
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies/models"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"gopkg.in/yaml.v3"
+)
+
+// testSigner is a functionary with an ECDSA key generated for a test.
+type testSigner struct {
+	name      string
+	signer    dsse.SignerVerifier
+	publicKey string
+}
+
+func newTestSigner(t *testing.T, name string) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{name: name, signer: signer, publicKey: string(pemPublicKey(&key.PublicKey))}
+}
+
+func (s *testSigner) functionary() *models.Functionary {
+	return &models.Functionary{Name: s.name, PublicKey: s.publicKey}
+}
+
+// testArtifacts maps artifact names to their sha256 digests.
+type testArtifacts map[string]string
+
+func (as testArtifacts) descriptors() []map[string]any {
+	var rds []map[string]any
+	for name, digest := range as {
+		rds = append(rds, map[string]any{"name": name, "digest": map[string]string{"sha256": digest}})
+	}
+	return rds
+}
+
+// newTestLink returns a link attestation of the step, named after it, signed
+// by every signer.
+func newTestLink(t *testing.T, step string, materials, products testArtifacts, signers ...*testSigner) *Attestation {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       products.descriptors(),
+		"predicateType": "https://in-toto.io/attestation/link/v0.3",
+		"predicate": map[string]any{
+			"name":      step,
+			"materials": materials.descriptors(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dsseSigners []dsse.Signer
+	for _, s := range signers {
+		dsseSigners = append(dsseSigners, s.signer)
+	}
+	es, err := dsse.NewEnvelopeSigner(dsseSigners...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := es.SignPayload(context.Background(), inTotoPayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Attestation{Name: step + ".link", Envelope: envelope}
+}
+
+// verifyTestPolicy verifies the policy document in YAML against the
+// attestations, with the signers as its functionaries.
+func verifyTestPolicy(t *testing.T, policy string, attestations []*Attestation, signers ...*testSigner) *VerificationResult {
+	t.Helper()
+	var pd models.PolicyDocument
+	if err := yaml.Unmarshal([]byte(policy), &pd); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range signers {
+		pd.Functionaries = append(pd.Functionaries, s.functionary())
+	}
+	v, err := NewVerifier(
+		WithKeySource(NewDirectoryKeySource("")),
+		WithAttestationSource(staticAttestationSource(attestations)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.Verify(pd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// testReasons returns the reasons the rule failed for, or nil if it passed.
+func testReasons(result *VerificationResult, rule string) []string {
+	for _, ar := range result.AttestationRules {
+		if ar.Name != rule {
+			continue
+		}
+		reasons := ar.Reasons
+		for _, p := range ar.Policies {
+			reasons = append(reasons, p.Reasons...)
+		}
+		return reasons
+	}
+	return nil
+}
+
+func TestVerifyBareDisallowRejectsNestedArtifacts(t *testing.T) {
+	alice := newTestSigner(t, "alice")
+	digest := strings.Repeat("a", 64)
+	const policy = `
+attestationRules:
+  - name: build
+    predicateType: https://in-toto.io/attestation/link/v0.3
+    allowedFunctionaries: [alice]
+    policies:
+      - type: https://in-toto.io/policy/artifact-rules/v0.1
+        definition:
+          field: this.subject
+          rules:
+            - ALLOW "main.o"
+            - DISALLOW "*"
+`
+	build := newTestLink(t, "build", nil, testArtifacts{"main.o": digest, "src/evil.o": digest}, alice)
+	result := verifyTestPolicy(t, policy, []*Attestation{build}, alice)
+	if result.Passed() {
+		t.Fatal(`expected DISALLOW "*" to reject the nested artifact src/evil.o`)
+	}
+	reasons := strings.Join(testReasons(result, "build"), "\n")
+	if !strings.Contains(reasons, "matched with a disallowed resource pattern '*': src/evil.o") {
+		t.Errorf("unexpected reasons: %s", reasons)
+	}
+
+	build = newTestLink(t, "build", nil, testArtifacts{"main.o": digest}, alice)
+	if result := verifyTestPolicy(t, policy, []*Attestation{build}, alice); !result.Passed() {
+		t.Errorf("expected the policy to pass without the nested artifact: %v", testReasons(result, "build"))
+	}
+}
@@ -0,0 +1,129 @@
+package policies
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	vsapb "github.com/in-toto/attestation/go/predicates/vsa/v1"
+	ita "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const VSAPredicateType = "https://slsa.dev/verification_summary/v1"
+
+// VSAOptions describes who verified which policy for a verification summary.
+type VSAOptions struct {
+	VerifierID string
+	PolicyURI  string
+	// PolicyDigest defaults to the digest of the policy document the result
+	// was verified with.
+	PolicyDigest map[string]string
+	// ResourceURI optionally names the resource the subjects were verified
+	// for, e.g. a package URL.
+	ResourceURI string
+	// VerifiedLevels are the levels the verification establishes, e.g.
+	// SLSA_BUILD_LEVEL_3.
+	VerifiedLevels []string
+	// TimeVerified defaults to the current time.
+	TimeVerified time.Time
+}
+
+// NewVSA summarizes a passed verification as a SLSA verification summary
+// statement. Its subjects are the subjects of the attestations that no other
+// attestation rule depends on, and its input attestations every attestation
+// that was verified.
+func NewVSA(result *VerificationResult, opts VSAOptions) (*ita.Statement, error) {
+	if !result.Passed() {
+		return nil, errors.New("cannot summarize a verification that did not pass")
+	}
+	if opts.VerifierID == "" {
+		return nil, errors.New("verification summary requires a verifier ID")
+	}
+	if len(result.subjects) == 0 {
+		return nil, errors.New("verification has no subjects to summarize")
+	}
+	if opts.TimeVerified.IsZero() {
+		opts.TimeVerified = time.Now()
+	}
+	if opts.PolicyDigest == nil {
+		opts.PolicyDigest = result.PolicyDigest
+	}
+
+	vsa := &vsapb.VerificationSummary{
+		Verifier:     &vsapb.VerificationSummary_Verifier{Id: opts.VerifierID},
+		TimeVerified: timestamppb.New(opts.TimeVerified),
+		ResourceUri:  opts.ResourceURI,
+		Policy: &vsapb.VerificationSummary_Policy{
+			Uri:    opts.PolicyURI,
+			Digest: opts.PolicyDigest,
+		},
+		VerificationResult: string(StatusPassed),
+	}
+	for _, ar := range result.ruleResults() {
+		for _, a := range ar.attestations {
+			digest := a.Digest
+			if digest == nil {
+				data, err := json.Marshal(a.Envelope)
+				if err != nil {
+					return nil, err
+				}
+				digest = sha256Digest(data)
+			}
+			vsa.InputAttestations = append(vsa.InputAttestations, &vsapb.VerificationSummary_InputAttestation{
+				Uri:    a.Name,
+				Digest: digest,
+			})
+		}
+	}
+
+	data, err := protojson.Marshal(vsa)
+	if err != nil {
+		return nil, err
+	}
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, predicate); err != nil {
+		return nil, err
+	}
+	// The VSA message declares verifiedLevels as a single string, while the
+	// SLSA specification makes it a list of levels.
+	if len(opts.VerifiedLevels) > 0 {
+		levels := make([]any, len(opts.VerifiedLevels))
+		for i, l := range opts.VerifiedLevels {
+			levels[i] = l
+		}
+		list, err := structpb.NewList(levels)
+		if err != nil {
+			return nil, err
+		}
+		predicate.Fields["verifiedLevels"] = structpb.NewListValue(list)
+	}
+	statement := &ita.Statement{
+		Type:          ita.StatementTypeUri,
+		Subject:       result.subjects,
+		PredicateType: VSAPredicateType,
+		Predicate:     predicate,
+	}
+	if err := statement.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid verification summary: %w", err)
+	}
+	return statement, nil
+}
+
+// SignStatement signs an in-toto statement into a DSSE envelope.
+func SignStatement(ctx context.Context, statement *ita.Statement, signers ...dsse.Signer) (*dsse.Envelope, error) {
+	payload, err := protojson.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	es, err := dsse.NewEnvelopeSigner(signers...)
+	if err != nil {
+		return nil, err
+	}
+	return es.SignPayload(ctx, inTotoPayloadType, payload)
+}
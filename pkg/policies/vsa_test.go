@@ -0,0 +1,58 @@
+package policies_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/alanssitis/in-toto-policies/pkg/policies"
+)
+
+func TestNewVSA(t *testing.T) {
+	const policyPath = "../../test/data/policy.yaml"
+	pd, err := policies.LoadPolicyDocument(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := policies.NewVerifier(
+		policies.WithKeySource(policies.NewDirectoryKeySource("../../test/data")),
+		policies.WithAttestationSource(policies.NewDirectoryAttestationSource("../../test/data", nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.Verify(pd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement, err := policies.NewVSA(result, policies.VSAOptions{
+		VerifierID:     "https://example.com/verifier",
+		PolicyURI:      policyPath,
+		ResourceURI:    "pkg:generic/testy",
+		VerifiedLevels: []string{"SLSA_BUILD_LEVEL_1", "SLSA_SOURCE_LEVEL_1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(raw)
+	fields := statement.Predicate.AsMap()
+	digest := fields["policy"].(map[string]any)["digest"].(map[string]any)
+	if digest["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("policy digest is %v, want the digest of the loaded policy", digest)
+	}
+	if fields["resourceUri"] != "pkg:generic/testy" {
+		t.Errorf("resource URI is %v", fields["resourceUri"])
+	}
+	levels, _ := fields["verifiedLevels"].([]any)
+	if !slices.Equal(levels, []any{"SLSA_BUILD_LEVEL_1", "SLSA_SOURCE_LEVEL_1"}) {
+		t.Errorf("verified levels are %v", fields["verifiedLevels"])
+	}
+}